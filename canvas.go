@@ -2,25 +2,46 @@ package vt100
 
 import (
 	"errors"
-	"fmt"
-	"os"
-	"strconv"
+	"io"
 	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
+// ColorRune is a canvas cell. The colors are interned, so that a cell is a
+// small fixed-size value that is cheap to copy and compare.
 type ColorRune struct {
-	fg    AttributeColor // Foreground color
-	bg    AttributeColor // Background color
-	r     rune           // The character to draw
-	drawn bool           // Has been drawn to screen yet?
+	r    rune    // The character to draw
+	fg   colorID // Foreground color
+	bg   colorID // Background color
+	text textID  // The grapheme cluster, if the cell holds more than one rune
+	link linkID  // The hyperlink that the cell is a part of, if any
 }
 
+// Anchor is the corner that the contents of a canvas stay in when it is resized
+type Anchor int
+
+const (
+	TopLeft Anchor = iota
+	TopRight
+	BottomLeft
+	BottomRight
+)
+
+// Size is the width and height of a canvas or terminal, in cells
+type Size struct {
+	W, H uint
+}
+
+// wideContinuation is the rune of a cell that is covered by the wide rune to the left of it
+const wideContinuation rune = -1
+
 // for API stability
 type Char ColorRune
 
 type Canvas struct {
 	mut           *sync.RWMutex
+	t             *Terminal
 	chars         []ColorRune
 	oldchars      []ColorRune
 	w             uint
@@ -28,10 +49,20 @@ type Canvas struct {
 	cursorVisible bool
 	lineWrap      bool
 	runewise      bool
+	offscreen     bool
+	repaint       bool         // the next Draw should repaint every cell
+	anchor        Anchor       // where the contents stay when resizing
+	texts         *stringTable // the texts of the cells, shared with the views
+	links         *stringTable // the hyperlink URLs of the cells, shared with the views
+	root          *Canvas      // the canvas that a view is a part of, or nil
+	ox            uint         // the position of a view within the root canvas
+	oy            uint
+	stride        uint // the width of the root canvas
 }
 
 // canvasCopy is a Canvas without the mutex
 type canvasCopy struct {
+	t             *Terminal
 	chars         []ColorRune
 	oldchars      []ColorRune
 	w             uint
@@ -39,44 +70,87 @@ type canvasCopy struct {
 	cursorVisible bool
 	lineWrap      bool
 	runewise      bool
+	offscreen     bool
+	stride        uint
 }
 
+// NewCanvas creates a new Canvas that has the size of the current terminal
+// and that draws to stdout
 func NewCanvas() *Canvas {
+	w, h := MustTermSize()
+	c := newCanvas(stdoutTerminal, w, h)
+	c.SetShowCursor(c.cursorVisible)
+	c.SetLineWrap(c.lineWrap)
+	return c
+}
+
+// NewCanvasWriter creates a new Canvas of the given size, that draws to
+// the given io.Writer instead of to stdout
+func NewCanvasWriter(w io.Writer, width, height uint) *Canvas {
+	c := newCanvas(NewTerminal(w), width, height)
+	c.SetShowCursor(c.cursorVisible)
+	c.SetLineWrap(c.lineWrap)
+	return c
+}
+
+// NewOffscreenCanvas creates a new Canvas of the given size that is never drawn
+// to a terminal. The terminal size is not queried and no terminal codes are
+// emitted, so it can be used for tests and for offscreen compositing.
+// The contents can be placed on another canvas with Blit.
+func NewOffscreenCanvas(width, height uint) *Canvas {
+	c := newCanvas(NewTerminal(io.Discard), width, height)
+	c.offscreen = true
+	return c
+}
+
+// newCanvas creates a new Canvas without emitting any terminal codes
+func newCanvas(t *Terminal, w, h uint) *Canvas {
 	c := &Canvas{}
-	c.w, c.h = MustTermSize()
+	c.t = t
+	c.w, c.h = w, h
+	c.stride = w
 	c.chars = make([]ColorRune, c.w*c.h)
 	for i := 0; i < len(c.chars); i++ {
-		c.chars[i].fg = Default
-		c.chars[i].bg = DefaultBackground
+		c.chars[i].fg = defaultID
+		c.chars[i].bg = defaultBackgroundID
 	}
 	c.oldchars = make([]ColorRune, 0)
+	c.texts, c.links = newStringTable(), newStringTable()
 	c.mut = &sync.RWMutex{}
 	c.cursorVisible = false
 	c.lineWrap = false
-	c.SetShowCursor(c.cursorVisible)
-	c.SetLineWrap(c.lineWrap)
 	return c
 }
 
 // Copy creates a new Canvas struct that is a copy of this one.
 // The mutex is initialized as a new mutex.
+// A copy of a view is a new canvas with only the cells of the view.
 func (c *Canvas) Copy() Canvas {
 	c.mut.RLock()
 	defer c.mut.RUnlock()
 
 	cc := canvasCopy{
-		chars:         make([]ColorRune, len(c.chars)),
-		oldchars:      make([]ColorRune, len(c.oldchars)),
+		t:             c.t,
+		chars:         make([]ColorRune, c.w*c.h),
+		oldchars:      make([]ColorRune, 0),
 		w:             c.w,
 		h:             c.h,
 		cursorVisible: c.cursorVisible,
 		lineWrap:      c.lineWrap,
 		runewise:      c.runewise,
+		offscreen:     c.offscreen,
+		stride:        c.w,
+	}
+	for y := uint(0); y < c.h; y++ {
+		copy(cc.chars[y*c.w:(y+1)*c.w], c.row(y))
+	}
+	if c.root == nil {
+		cc.oldchars = make([]ColorRune, len(c.oldchars))
+		copy(cc.oldchars, c.oldchars)
 	}
-	copy(cc.chars, c.chars)
-	copy(cc.oldchars, c.oldchars)
 
 	return Canvas{
+		t:             cc.t,
 		chars:         cc.chars,
 		oldchars:      cc.oldchars,
 		w:             cc.w,
@@ -84,26 +158,83 @@ func (c *Canvas) Copy() Canvas {
 		cursorVisible: cc.cursorVisible,
 		lineWrap:      cc.lineWrap,
 		runewise:      cc.runewise,
+		offscreen:     cc.offscreen,
+		stride:        cc.stride,
+		texts:         c.texts.clone(),
+		links:         c.links.clone(),
 		mut:           &sync.RWMutex{},
 	}
 }
 
+// Sub returns a view of the rectangle at x,y with the given width and height.
+// The view shares the cells and the mutex of this canvas, but has its own
+// coordinate system, where 0,0 is the upper left corner of the rectangle.
+// Everything that is written to the view is clipped to the rectangle.
+// Views can be nested, and drawing a view draws the canvas it is a part of.
+// A view should not be used after the canvas it is a part of has been resized.
+func (c *Canvas) Sub(x, y, w, h uint) *Canvas {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	x, y = umin(x, c.w), umin(y, c.h)
+	v := &Canvas{}
+	*v = Canvas{
+		mut:       c.mut,
+		t:         c.t,
+		chars:     c.chars,
+		w:         umin(w, c.w-x),
+		h:         umin(h, c.h-y),
+		offscreen: c.offscreen,
+		texts:     c.texts,
+		links:     c.links,
+		root:      c.top(),
+		ox:        c.ox + x,
+		oy:        c.oy + y,
+		stride:    c.stride,
+	}
+	return v
+}
+
+// top returns the canvas that this view is a part of, or the canvas itself
+func (c *Canvas) top() *Canvas {
+	if c.root != nil {
+		return c.root
+	}
+	return c
+}
+
+// index returns the position of the cell at x,y in c.chars
+func (c *Canvas) index(x, y uint) uint {
+	return (c.oy+y)*c.stride + c.ox + x
+}
+
+// row returns the cells of line y
+func (c *Canvas) row(y uint) []ColorRune {
+	i := c.index(0, y)
+	return c.chars[i : i+c.w]
+}
+
 // Change the background color for each character
 func (c *Canvas) FillBackground(bg AttributeColor) {
-	converted := bg.Background()
+	converted := internBackground(bg)
 	c.mut.Lock()
-	for i := range c.chars {
-		c.chars[i].bg = converted
-		c.chars[i].drawn = false
+	for y := uint(0); y < c.h; y++ {
+		row := c.row(y)
+		for i := range row {
+			row[i].bg = converted
+		}
 	}
 	c.mut.Unlock()
 }
 
 // Change the foreground color for each character
 func (c *Canvas) Fill(fg AttributeColor) {
+	fgID := internColor(fg)
 	c.mut.Lock()
-	for i := range c.chars {
-		c.chars[i].fg = fg
+	for y := uint(0); y < c.h; y++ {
+		row := c.row(y)
+		for i := range row {
+			row[i].fg = fgID
+		}
 	}
 	c.mut.Unlock()
 }
@@ -112,14 +243,11 @@ func (c *Canvas) Fill(fg AttributeColor) {
 func (c *Canvas) String() string {
 	var sb strings.Builder
 	c.mut.RLock()
+	texts := c.texts.strings
 	for y := uint(0); y < c.h; y++ {
-		for x := uint(0); x < c.w; x++ {
-			cr := &((*c).chars[y*c.w+x])
-			if cr.r == rune(0) {
-				sb.WriteRune(' ')
-			} else {
-				sb.WriteRune(cr.r)
-			}
+		row := c.row(y)
+		for x := range row {
+			writeGlyph(&sb, row, x, texts)
 		}
 		sb.WriteRune('\n')
 	}
@@ -127,100 +255,201 @@ func (c *Canvas) String() string {
 	return sb.String()
 }
 
-// PlotAll tries to plot each individual rune.
+// PlotAll tries to plot each individual cell, with its own cursor movement and colors.
 // It's very inefficient and meant to be used as a robust fallback.
 func (c *Canvas) PlotAll() {
-	w := c.w
-	h := c.h
+	if c.offscreen {
+		return
+	}
 	c.mut.Lock()
-	for y := uint(0); y < h; y++ {
-		for x := int(w - 1); x >= 0; x-- {
-			cr := &((*c).chars[y*w+uint(x)])
-			r := cr.r
-			if cr.r == rune(0) {
-				r = ' '
-				//continue
+	defer c.mut.Unlock()
+	texts := c.texts.strings
+	var sb strings.Builder
+	for y := uint(0); y < c.h; y++ {
+		row := c.row(y)
+		for x := len(row) - 1; x >= 0; x-- {
+			sb.Reset()
+			if writeGlyph(&sb, row, x, texts) == 0 {
+				// The right half of a wide cell is drawn together with the left half
+				continue
 			}
-			SetXY(uint(x), y)
-			fmt.Print(cr.fg.Combine(cr.bg).String() + string(r) + NoColor())
+			cr := &row[x]
+			c.t.SetXY(c.ox+uint(x), c.oy+y)
+			c.t.Print(colorOf(cr.fg).Combine(colorOf(cr.bg)).String() + sb.String() + NoColor())
 		}
 	}
-	c.mut.Unlock()
 }
 
 // Return the size of the current canvas
 func (c *Canvas) Size() (uint, uint) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
 	return c.w, c.h
 }
 
 func (c *Canvas) Width() uint {
-	return c.w
+	return c.W()
 }
 
 func (c *Canvas) Height() uint {
-	return c.h
+	return c.H()
+}
+
+// Terminal returns the Terminal that this canvas draws to
+func (c *Canvas) Terminal() *Terminal {
+	return c.t
+}
+
+// Offscreen returns true if this canvas is never drawn to a terminal
+func (c *Canvas) Offscreen() bool {
+	return c.offscreen
 }
 
 // Move cursor to the given position (0,0 is top left)
 func SetXY(x, y uint) {
-	// Add 1 to y to make the position correct
-	Set("Cursor Home", map[string]string{"{ROW}": strconv.Itoa(int(y + 1)), "{COLUMN}": strconv.Itoa(int(x + 1))})
+	stdoutTerminal.SetXY(x, y)
 }
 
 // Move the cursor down
 func Down(n uint) {
-	Set("Cursor Down", map[string]string{"{COUNT}": strconv.Itoa(int(n))})
+	stdoutTerminal.Down(n)
 }
 
 // Move the cursor up
 func Up(n uint) {
-	Set("Cursor Up", map[string]string{"{COUNT}": strconv.Itoa(int(n))})
+	stdoutTerminal.Up(n)
 }
 
 // Move the cursor to the right
 func Right(n uint) {
-	Set("Cursor Forward", map[string]string{"{COUNT}": strconv.Itoa(int(n))})
+	stdoutTerminal.Right(n)
 }
 
 // Move the cursor to the left
 func Left(n uint) {
-	Set("Cursor Backward", map[string]string{"{COUNT}": strconv.Itoa(int(n))})
+	stdoutTerminal.Left(n)
 }
 
 func Home() {
-	Set("Cursor Home", map[string]string{"{ROW};{COLUMN}": ""})
+	stdoutTerminal.Home()
+}
+
+// Move the cursor to the given column of the current row (0 is the leftmost column)
+func Column(x uint) {
+	stdoutTerminal.Column(x)
+}
+
+// Move the cursor to the given row, without changing the column (0 is the top row)
+func Row(y uint) {
+	stdoutTerminal.Row(y)
+}
+
+// Move the cursor to the start of the line n rows down
+func NextLine(n uint) {
+	stdoutTerminal.NextLine(n)
+}
+
+// Move the cursor to the start of the line n rows up
+func PreviousLine(n uint) {
+	stdoutTerminal.PreviousLine(n)
+}
+
+// Insert n blank lines at the cursor
+func InsertLines(n uint) {
+	stdoutTerminal.InsertLines(n)
+}
+
+// Delete n lines, starting with the line of the cursor
+func DeleteLines(n uint) {
+	stdoutTerminal.DeleteLines(n)
+}
+
+// Insert n blank characters at the cursor
+func InsertChars(n uint) {
+	stdoutTerminal.InsertChars(n)
+}
+
+// Delete n characters at the cursor
+func DeleteChars(n uint) {
+	stdoutTerminal.DeleteChars(n)
+}
+
+// Erase n characters, starting at the cursor
+func EraseChars(n uint) {
+	stdoutTerminal.EraseChars(n)
+}
+
+// Scroll the screen up n lines
+func ScrollUp(n uint) {
+	stdoutTerminal.ScrollUp(n)
+}
+
+// Scroll the screen down n lines
+func ScrollDown(n uint) {
+	stdoutTerminal.ScrollDown(n)
+}
+
+// Soft reset of the terminal, without clearing the screen
+func SoftReset() {
+	stdoutTerminal.SoftReset()
 }
 
 func Reset() {
-	Do("Reset Device")
+	stdoutTerminal.Reset()
 }
 
 // Clear screen
 func Clear() {
-	Do("Erase Screen")
+	stdoutTerminal.Clear()
 }
 
 // Clear canvas
 func (c *Canvas) Clear() {
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	for _, cr := range c.chars {
-		cr.r = rune(0)
-		cr.drawn = false
+	if c.root != nil && c.w > 0 {
+		// Wide runes may cross the edges of a view
+		for y := uint(0); y < c.h; y++ {
+			c.unwide(c.index(0, y))
+			c.unwide(c.index(c.w-1, y))
+		}
+	}
+	for y := uint(0); y < c.h; y++ {
+		row := c.row(y)
+		for i := range row {
+			row[i].r, row[i].text = rune(0), 0
+		}
+	}
+	if c.root == nil {
+		c.compactStrings()
 	}
 }
 
 func (c *Canvas) SetLineWrap(enable bool) {
+	if c.root != nil {
+		c.root.SetLineWrap(enable)
+		return
+	}
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	SetLineWrap(enable)
+	if c.offscreen {
+		return
+	}
+	c.t.SetLineWrap(enable)
 }
 
 func (c *Canvas) SetShowCursor(enable bool) {
+	if c.root != nil {
+		c.root.SetShowCursor(enable)
+		return
+	}
 	c.mut.Lock()
 	defer c.mut.Unlock()
 	c.cursorVisible = enable
-	ShowCursor(enable)
+	if c.offscreen {
+		return
+	}
+	c.t.ShowCursor(enable)
 }
 
 func (c *Canvas) W() uint {
@@ -246,339 +475,196 @@ func (c *Canvas) ShowCursor() {
 func (c *Canvas) SetRunewise(b bool) {
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	c.runewise = b
+	c.top().runewise = b
 }
 
 // DrawAndSetCursor draws the entire canvas and then places the cursor at x,y
 func (c *Canvas) DrawAndSetCursor(x, y uint) {
 	c.Draw()
 	// Reposition the cursor
-	SetXY(x, y)
+	c.t.SetXY(c.ox+x, c.oy+y)
 }
 
-// HideCursorAndDraw will hide the cursor and then draw the entire canvas
-func (c *Canvas) HideCursorAndDraw() {
-
-	c.cursorVisible = false
-	c.SetShowCursor(false)
-
-	var (
-		lastfg = Default // AttributeColor
-		lastbg = Default // AttributeColor
-		cr     ColorRune
-		oldcr  ColorRune
-		sb     strings.Builder
-	)
-
-	cr.fg = Default
-	cr.bg = Default
-	oldcr.fg = Default
-	oldcr.bg = Default
-
-	// NOTE: If too many runes are written to the screen, the contents will scroll up,
-	// and it will appear like the first line(s) are lost!
-
+// At returns the rune at the given coordinates, or an error if out of bounds.
+// For the right half of a wide rune, the wide rune is returned.
+func (c *Canvas) At(x, y uint) (rune, error) {
 	c.mut.RLock()
-
-	if len((*c).chars) == 0 {
-		c.mut.RUnlock()
-		return
-	}
-
-	firstRun := len(c.oldchars) == 0
-	skipAll := !firstRun // true by default, except for the first run
-
-	size := c.w*c.h - 1
-	sb.Grow(int(size))
-
-	if !firstRun {
-		for index := uint(0); index < size; index++ {
-			cr = (*c).chars[index]
-			oldcr = (*c).oldchars[index]
-			if cr.fg.Equal(lastfg) && cr.fg.Equal(oldcr.fg) && cr.bg.Equal(lastbg) && cr.bg.Equal(oldcr.bg) && cr.r == oldcr.r {
-				// One is not skippable, can not skip all
-				skipAll = false
-			}
-			// Only output a color code if it's different from the last character, or it's the first one
-			if (index == 0) || !lastfg.Equal(cr.fg) || !lastbg.Equal(cr.bg) {
-				// Write to the string builder
-				sb.WriteString(cr.fg.Combine(cr.bg).String())
-			}
-			// Write the character
-			if cr.r != 0 {
-				sb.WriteRune(cr.r)
-			} else {
-				sb.WriteRune(' ')
-			}
-			lastfg = cr.fg
-			lastbg = cr.bg
-		}
-	} else {
-		for index := uint(0); index < size; index++ {
-			cr = (*c).chars[index]
-			// Only output a color code if it's different from the last character, or it's the first one
-			if (index == 0) || !lastfg.Equal(cr.fg) || !lastbg.Equal(cr.bg) {
-				// Write to the string builder
-				sb.WriteString(cr.fg.Combine(cr.bg).String())
-			}
-			// Write the character
-			if cr.r != 0 {
-				sb.WriteRune(cr.r)
-			} else {
-				sb.WriteRune(' ')
-			}
-			lastfg = cr.fg
-			lastbg = cr.bg
-		}
-	}
-
-	c.mut.RUnlock()
-
-	// The screenfull so far is correct (sb.String())
-
-	if skipAll {
-		return
-	}
-
-	// Enable line wrap, temporarily, if it's disabled
-	reDisableLineWrap := false
-	if !c.lineWrap {
-		c.SetLineWrap(true)
-		reDisableLineWrap = true
-	}
-
-	// Draw each and every line, or push one large string to screen?
-	if c.runewise {
-
-		Clear()
-		c.PlotAll()
-
-	} else {
-		c.mut.Lock()
-		SetXY(0, 0)
-		os.Stdout.Write([]byte(sb.String()))
-		c.mut.Unlock()
-	}
-
-	// Restore the line wrap, if it was temporarily enabled
-	if reDisableLineWrap {
-		c.SetLineWrap(false)
+	defer c.mut.RUnlock()
+	if x >= c.w || y >= c.h {
+		return rune(0), errors.New("out of bounds")
 	}
-
-	// Save the current state to oldchars
-	c.mut.Lock()
-	if lc := len(c.chars); len(c.oldchars) != lc {
-		c.oldchars = make([]ColorRune, lc)
+	chars := (*c).chars
+	index := c.index(x, y)
+	if chars[index].r == wideContinuation && x > 0 {
+		return chars[index-1].r, nil
 	}
-	copy(c.oldchars, c.chars)
-	c.mut.Unlock()
+	return chars[index].r, nil
 }
 
-// Draw the entire canvas
-func (c *Canvas) Draw() {
-	var (
-		lastfg = Default // AttributeColor
-		lastbg = Default // AttributeColor
-		cr     ColorRune
-		oldcr  ColorRune
-		sb     strings.Builder
-	)
-
-	cr.fg = Default
-	cr.bg = Default
-	oldcr.fg = Default
-	oldcr.bg = Default
-
-	// NOTE: If too many runes are written to the screen, the contents will scroll up,
-	// and it will appear like the first line(s) are lost!
-
-	c.mut.RLock()
-
-	if len((*c).chars) == 0 {
-		c.mut.RUnlock()
-		return
-	}
-
-	firstRun := len(c.oldchars) == 0
-	skipAll := !firstRun // true by default, except for the first run
-
-	size := c.w*c.h - 1
-	sb.Grow(int(size))
-
-	if !firstRun {
-		for index := uint(0); index < size; index++ {
-			cr = (*c).chars[index]
-			oldcr = (*c).oldchars[index]
-			if cr.fg.Equal(lastfg) && cr.fg.Equal(oldcr.fg) && cr.bg.Equal(lastbg) && cr.bg.Equal(oldcr.bg) && cr.r == oldcr.r {
-				// One is not skippable, can not skip all
-				skipAll = false
-			}
-			// Only output a color code if it's different from the last character, or it's the first one
-			if (index == 0) || !lastfg.Equal(cr.fg) || !lastbg.Equal(cr.bg) {
-				// Write to the string builder
-				sb.WriteString(cr.fg.Combine(cr.bg).String())
-			}
-			// Write the character
-			if cr.r != 0 {
-				sb.WriteRune(cr.r)
-			} else {
-				sb.WriteRune(' ')
-			}
-			lastfg = cr.fg
-			lastbg = cr.bg
-		}
-	} else {
-		for index := uint(0); index < size; index++ {
-			cr = (*c).chars[index]
-			// Only output a color code if it's different from the last character, or it's the first one
-			if (index == 0) || !lastfg.Equal(cr.fg) || !lastbg.Equal(cr.bg) {
-				// Write to the string builder
-				sb.WriteString(cr.fg.Combine(cr.bg).String())
-			}
-			// Write the character
-			if cr.r != 0 {
-				sb.WriteRune(cr.r)
-			} else {
-				sb.WriteRune(' ')
-			}
-			lastfg = cr.fg
-			lastbg = cr.bg
+// unwide replaces the wide rune that covers the cell at the given index with
+// spaces, if there is one. The canvas mutex must be held.
+func (c *Canvas) unwide(i uint) {
+	x := i % c.stride
+	if c.chars[i].r == wideContinuation {
+		if x > 0 {
+			c.chars[i-1].r, c.chars[i-1].text = ' ', 0
 		}
+		c.chars[i].r = ' '
+	} else if x+1 < c.stride && c.chars[i+1].r == wideContinuation {
+		c.chars[i+1].r = ' '
 	}
+}
 
-	c.mut.RUnlock()
-
-	// The screenfull so far is correct (sb.String())
-
-	if skipAll {
-		return
-	}
-
-	// Output the combined string, also disable the color codes
-
-	// Hide the cursor, temporarily, if it's visible
-	reEnableCursor := false
-	if c.cursorVisible {
-		c.SetShowCursor(false)
-		reEnableCursor = true
-	}
-
-	// Enable line wrap, temporarily, if it's disabled
-	reDisableLineWrap := false
-	if !c.lineWrap {
-		c.SetLineWrap(true)
-		reDisableLineWrap = true
-	}
-
-	// Draw each and every line, or push one large string to screen?
-	if c.runewise {
-
-		Clear()
-		c.PlotAll()
-
-	} else {
-		c.mut.Lock()
-		SetXY(0, 0)
-		os.Stdout.Write([]byte(sb.String()))
-		c.mut.Unlock()
-	}
-
-	// Restore the cursor, if it was temporarily hidden
-	if reEnableCursor {
-		c.SetShowCursor(true)
+// attach adds zero-width runes, like combining marks, to the grapheme cluster
+// of the cell at the given index. If this changes the width of the cell,
+// it is placed again. The canvas mutex must be held.
+func (c *Canvas) attach(i uint, s string) {
+	if c.chars[i].r == wideContinuation && i%c.stride > c.ox {
+		i--
 	}
-
-	// Restore the line wrap, if it was temporarily enabled
-	if reDisableLineWrap {
-		c.SetLineWrap(false)
+	cr := c.chars[i]
+	text := c.texts.strings[cr.text]
+	switch {
+	case text != "":
+	case cr.r == 0 || cr.r == wideContinuation:
+		cr.r = ' '
+		text = " "
+	default:
+		text = string(cr.r)
 	}
-
-	// Save the current state to oldchars
-	c.mut.Lock()
-	c.oldchars = make([]ColorRune, len(c.chars))
-	copy(c.oldchars, c.chars)
-	c.mut.Unlock()
-}
-
-func (c *Canvas) Redraw() {
-	c.mut.Lock()
-	for _, cr := range c.chars {
-		cr.drawn = false
+	width := clusterWidth(text)
+	cr.text = textID(c.texts.intern(text + s))
+	if clusterWidth(text+s) != width {
+		c.put(i, cr)
+		return
 	}
-	c.mut.Unlock()
-	c.Draw()
+	c.chars[i] = cr
 }
 
-func (c *Canvas) HideCursorAndRedraw() {
-	c.mut.Lock()
-	for _, cr := range c.chars {
-		cr.drawn = false
+// put places a cell at the given index, which must be within range.
+// A wide cell also takes up the cell to the right of it, and any wide cell
+// that is partially overwritten is replaced with spaces. A wide cell that
+// does not fit at the end of a line, or at the right edge of a view,
+// is replaced with a space.
+// A zero-width rune is attached to the cell to the left instead.
+// Returns the number of cells that were used. The canvas mutex must be held.
+func (c *Canvas) put(i uint, cr ColorRune) uint {
+	x := i % c.stride
+	width := RuneWidth(cr.r)
+	if cr.text != 0 {
+		width = cr.width(c.texts.strings)
 	}
-	c.mut.Unlock()
-	c.HideCursorAndDraw()
-}
-
-// At returns the rune at the given coordinates, or an error if out of bounds
-func (c *Canvas) At(x, y uint) (rune, error) {
-	c.mut.RLock()
-	defer c.mut.RUnlock()
-	chars := (*c).chars
-	index := y*c.w + x
-	if index < uint(0) || index >= uint(len(chars)) {
-		return rune(0), errors.New("out of bounds")
+	switch width {
+	case 0:
+		if x > c.ox {
+			c.attach(i-1, string(cr.r))
+		}
+		return 0
+	case 2:
+		c.unwide(i)
+		if x+1 >= c.ox+c.w {
+			cr.r, cr.text = ' ', 0
+			c.chars[i] = cr
+			return 1
+		}
+		c.unwide(i + 1)
+		c.chars[i] = cr
+		c.chars[i+1] = ColorRune{r: wideContinuation, fg: cr.fg, bg: cr.bg, link: cr.link}
+		return 2
 	}
-	return chars[index].r, nil
+	c.unwide(i)
+	c.chars[i] = cr
+	return 1
 }
 
 func (c *Canvas) Plot(x, y uint, r rune) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	if x >= c.w || y >= c.h {
 		return
 	}
-	index := y*c.w + x
-	c.mut.Lock()
-	chars := (*c).chars
-	chars[index].r = r
-	chars[index].drawn = false
-	c.mut.Unlock()
+	index := c.index(x, y)
+	cr := (*c).chars[index]
+	cr.r, cr.text = r, 0
+	c.put(index, cr)
 }
 
 func (c *Canvas) PlotColor(x, y uint, fg AttributeColor, r rune) {
+	fgID := internColor(fg)
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	if x >= c.w || y >= c.h {
 		return
 	}
-	index := y*c.w + x
-	c.mut.Lock()
-	chars := (*c).chars
-	chars[index].r = r
-	chars[index].fg = fg
-	chars[index].drawn = false
-	c.mut.Unlock()
+	index := c.index(x, y)
+	cr := (*c).chars[index]
+	cr.r, cr.fg, cr.text = r, fgID, 0
+	c.put(index, cr)
 }
 
 // WriteString will write a string to the canvas.
+// The string is split into grapheme clusters, like a letter with combining marks,
+// an emoji sequence or a flag, and each cluster is placed in one cell.
+// Wide clusters take up two cells. Zero-width runes at the start of the string
+// are attached to the cell to the left.
+// The text continues on the next line if it is too long to fit.
 func (c *Canvas) WriteString(x, y uint, fg, bg AttributeColor, s string) {
+	c.writeString(x, y, fg, bg, s, "")
+}
+
+// WriteLink writes a string to the canvas, like WriteString, where the text is a hyperlink
+// to the given URL. Terminal emulators that support OSC 8 hyperlinks let the user click on it,
+// and other terminal emulators just show the text. Writing over the cells removes the link.
+func (c *Canvas) WriteLink(x, y uint, fg, bg AttributeColor, s, url string) {
+	c.writeString(x, y, fg, bg, s, strings.Map(func(r rune) rune {
+		// Control characters would end the hyperlink escape sequence early
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, url))
+}
+
+// writeString writes a string to the canvas, where each cell is a part of the hyperlink
+// to the given URL, if it is not empty
+func (c *Canvas) writeString(x, y uint, fg, bg AttributeColor, s, url string) {
+	fgID, bgID := internColor(fg), internBackground(bg)
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	if x >= c.w || y >= c.h {
 		return
 	}
-	c.mut.RLock()
-	chars := (*c).chars
-	counter := uint(0)
-	startpos := y*c.w + x
-	lchars := uint(len(chars))
-	c.mut.RUnlock()
-	bgb := bg.Background()
-	for _, r := range s {
-		i := startpos + counter
-		if i >= lchars {
+	link := linkID(c.links.intern(url))
+	cx, cy := x, y
+	for s != "" {
+		var cluster string
+		cluster, s = nextGrapheme(s)
+		width := clusterWidth(cluster)
+		if width == 0 {
+			if cx > 0 {
+				c.attach(c.index(cx-1, cy), cluster)
+			} else if cy > 0 {
+				c.attach(c.index(c.w-1, cy-1), cluster)
+			}
+			continue
+		}
+		if width == 2 && cx == c.w-1 {
+			// Pad the end of the line, and place the wide cluster on the next line
+			c.put(c.index(cx, cy), ColorRune{r: ' ', fg: fgID, bg: bgID, link: link})
+			cx++
+		}
+		if cx >= c.w {
+			cx, cy = 0, cy+1
+		}
+		if cy >= c.h {
 			break
 		}
-		c.mut.Lock()
-		chars[i].r = r
-		chars[i].fg = fg
-		chars[i].bg = bgb
-		chars[i].drawn = false
-		c.mut.Unlock()
-		counter++
+		r, size := utf8.DecodeRuneInString(cluster)
+		cr := ColorRune{r: r, fg: fgID, bg: bgID, link: link}
+		if size < len(cluster) {
+			cr.text = textID(c.texts.intern(cluster))
+		}
+		cx += c.put(c.index(cx, cy), cr)
 	}
 }
 
@@ -588,65 +674,71 @@ func (c *Canvas) Write(x, y uint, fg, bg AttributeColor, s string) {
 
 // WriteRune will write a colored rune to the canvas
 func (c *Canvas) WriteRune(x, y uint, fg, bg AttributeColor, r rune) {
+	cr := ColorRune{r: r, fg: internColor(fg), bg: internBackground(bg)}
+	c.mut.Lock()
+	defer c.mut.Unlock()
 	if x >= c.w || y >= c.h {
 		return
 	}
-	index := y*c.w + x
-	c.mut.Lock()
-	defer c.mut.Unlock()
-	chars := (*c).chars
-	chars[index].r = r
-	chars[index].fg = fg
-	chars[index].bg = bg.Background()
-	chars[index].drawn = false
+	c.put(c.index(x, y), cr)
 }
 
 // WriteRuneB will write a colored rune to the canvas
-// The x and y must be within range (x < c.w and y < c.h)
 func (c *Canvas) WriteRuneB(x, y uint, fg, bgb AttributeColor, r rune) {
-	index := y*c.w + x
+	cr := ColorRune{r: r, fg: internColor(fg), bg: internColor(bgb)}
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	(*c).chars[index] = ColorRune{fg, bgb, r, false}
+	if x >= c.w || y >= c.h {
+		return
+	}
+	c.put(c.index(x, y), cr)
 }
 
 // WriteRuneBNoLock will write a colored rune to the canvas
-// The x and y must be within range (x < c.w and y < c.h)
 // The canvas mutex is not locked
 func (c *Canvas) WriteRuneBNoLock(x, y uint, fg, bgb AttributeColor, r rune) {
-	(*c).chars[y*c.w+x] = ColorRune{fg, bgb, r, false}
+	if x >= c.w || y >= c.h {
+		return
+	}
+	c.put(c.index(x, y), ColorRune{r: r, fg: internColor(fg), bg: internColor(bgb)})
 }
 
 // WriteBackground will write a background color to the canvas
-// The x and y must be within range (x < c.w and y < c.h)
 func (c *Canvas) WriteBackground(x, y uint, bg AttributeColor) {
-	index := y*c.w + x
+	bgID := internColor(bg)
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	(*c).chars[index].bg = bg
-	(*c).chars[index].drawn = false
+	if x >= c.w || y >= c.h {
+		return
+	}
+	(*c).chars[c.index(x, y)].bg = bgID
 }
 
 // WriteBackgroundAddRuneIfEmpty will write a background color to the canvas
-// The x and y must be within range (x < c.w and y < c.h)
 func (c *Canvas) WriteBackgroundAddRuneIfEmpty(x, y uint, bg AttributeColor, r rune) {
-	index := y*c.w + x
+	bgID := internColor(bg)
 	c.mut.Lock()
 	defer c.mut.Unlock()
-	(*c).chars[index].bg = bg
+	if x >= c.w || y >= c.h {
+		return
+	}
+	index := c.index(x, y)
+	(*c).chars[index].bg = bgID
 	if (*c).chars[index].r == 0 {
-		(*c).chars[index].r = r
+		cr := (*c).chars[index]
+		cr.r = r
+		c.put(index, cr)
 	}
-	(*c).chars[index].drawn = false
 }
 
 // WriteBackgroundNoLock will write a background color to the canvas
-// The x and y must be within range (x < c.w and y < c.h)
 // The canvas mutex is not locked
 func (c *Canvas) WriteBackgroundNoLock(x, y uint, bg AttributeColor) {
-	index := y*c.w + x
-	(*c).chars[index].bg = bg
-	(*c).chars[index].drawn = false
+	if x >= c.w || y >= c.h {
+		return
+	}
+	index := c.index(x, y)
+	(*c).chars[index].bg = internColor(bg)
 }
 
 func (c *Canvas) Lock() {
@@ -660,66 +752,290 @@ func (c *Canvas) Unlock() {
 // WriteRunesB will write repeated colored runes to the canvas.
 // This is the same as WriteRuneB, but bg.Background() has already been called on
 // the background attribute.
-// The x and y must be within range (x < c.w and y < c.h). x + count must be within range too.
+// The runes are clipped to the end of the line.
 func (c *Canvas) WriteRunesB(x, y uint, fg, bgb AttributeColor, r rune, count uint) {
-	startIndex := y*c.w + x
-	afterLastIndex := startIndex + count
+	cr := ColorRune{r: r, fg: internColor(fg), bg: internColor(bgb)}
 	c.mut.Lock()
-	chars := (*c).chars
-	for i := startIndex; i < afterLastIndex; i++ {
-		chars[i] = ColorRune{fg, bgb, r, false}
+	defer c.mut.Unlock()
+	if x >= c.w || y >= c.h {
+		return
+	}
+	startIndex := c.index(x, y)
+	afterLastIndex := startIndex + umin(count, c.w-x)
+	for i := startIndex; i < afterLastIndex; {
+		n := c.put(i, cr)
+		if n == 0 {
+			break
+		}
+		i += n
+	}
+}
+
+// Blit copies the contents of the src canvas onto this canvas, with the
+// upper left corner of src placed at x,y. Anything outside of this canvas is clipped.
+func (c *Canvas) Blit(src *Canvas, x, y uint) {
+	// Copy the source first, since it may be a view that shares the mutex with this canvas
+	src.mut.RLock()
+	sw, sh := src.w, src.h
+	rows := make([]ColorRune, sw*sh)
+	for sy := uint(0); sy < sh; sy++ {
+		copy(rows[sy*sw:(sy+1)*sw], src.row(sy))
+	}
+	texts, links := src.texts.strings, src.links.strings
+	src.mut.RUnlock()
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if x >= c.w || y >= c.h {
+		return
+	}
+	// The cell texts and URLs of the source are looked up in the tables of this canvas
+	for i := range rows {
+		cr := &rows[i]
+		if cr.text != 0 {
+			cr.text = textID(c.texts.intern(texts[cr.text]))
+		}
+		if cr.link != 0 {
+			cr.link = linkID(c.links.intern(links[cr.link]))
+		}
+	}
+	w, h := umin(sw, c.w-x), umin(sh, c.h-y)
+	if w == 0 {
+		return
+	}
+	for sy := uint(0); sy < h; sy++ {
+		srcRow := rows[sy*sw : (sy+1)*sw]
+		left := c.index(x, y+sy)
+		right := left + w - 1
+		c.unwide(left)
+		c.unwide(right)
+		copy(c.chars[left:right+1], srcRow[:w])
+		// Replace wide runes that are cut in half by the edges with spaces
+		if c.chars[left].r == wideContinuation {
+			c.chars[left].r = ' '
+		}
+		if w < sw && srcRow[w].r == wideContinuation {
+			c.chars[right].r, c.chars[right].text = ' ', 0
+		}
+	}
+}
+
+// blank is an empty cell with the default colors
+var blank = ColorRune{fg: defaultID, bg: defaultBackgroundID}
+
+// unwideEdges replaces wide runes that cross the left or right edge of a view with
+// spaces, for the rows from y0 up to y1, so that the rows can be moved.
+// The canvas mutex must be held.
+func (c *Canvas) unwideEdges(y0, y1 uint) {
+	if c.root == nil || c.w == 0 {
+		return
+	}
+	for y := y0; y < y1; y++ {
+		c.unwide(c.index(0, y))
+		c.unwide(c.index(c.w-1, y))
+	}
+}
+
+// InsertLines inserts n blank lines at line y, like the "Insert Lines" terminal command.
+// The lines below are moved down, and the lines that are moved past the bottom are lost.
+func (c *Canvas) InsertLines(y, n uint) {
+	c.mut.Lock()
+	c.insertLines(y, n)
+	c.mut.Unlock()
+}
+
+// insertLines inserts n blank lines at line y. The canvas mutex must be held.
+func (c *Canvas) insertLines(y, n uint) {
+	if y >= c.h || n == 0 {
+		return
+	}
+	n = umin(n, c.h-y)
+	c.unwideEdges(y, c.h)
+	for dy := c.h - 1; dy >= y+n; dy-- {
+		copy(c.row(dy), c.row(dy-n))
 	}
+	for dy := y; dy < y+n; dy++ {
+		row := c.row(dy)
+		for i := range row {
+			row[i] = blank
+		}
+	}
+}
+
+// DeleteLines deletes n lines, starting with line y, like the "Delete Lines" terminal command.
+// The lines below are moved up, and blank lines are added at the bottom.
+func (c *Canvas) DeleteLines(y, n uint) {
+	c.mut.Lock()
+	c.deleteLines(y, n)
 	c.mut.Unlock()
 }
 
+// deleteLines deletes n lines, starting with line y. The canvas mutex must be held.
+func (c *Canvas) deleteLines(y, n uint) {
+	if y >= c.h || n == 0 {
+		return
+	}
+	n = umin(n, c.h-y)
+	c.unwideEdges(y, c.h)
+	for dy := y; dy+n < c.h; dy++ {
+		copy(c.row(dy), c.row(dy+n))
+	}
+	for dy := c.h - n; dy < c.h; dy++ {
+		row := c.row(dy)
+		for i := range row {
+			row[i] = blank
+		}
+	}
+}
+
+// ScrollUp moves the contents of the canvas up n lines, and adds blank lines at the bottom
+func (c *Canvas) ScrollUp(n uint) {
+	c.DeleteLines(0, n)
+}
+
+// ScrollDown moves the contents of the canvas down n lines, and adds blank lines at the top
+func (c *Canvas) ScrollDown(n uint) {
+	c.InsertLines(0, n)
+}
+
+// InsertChars inserts n blank cells at x,y, like the "Insert Characters" terminal command.
+// The rest of the line is moved to the right, and the cells that are moved past the
+// right edge are lost.
+func (c *Canvas) InsertChars(x, y, n uint) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if x >= c.w || y >= c.h || n == 0 {
+		return
+	}
+	n = umin(n, c.w-x)
+	c.unwideEdges(y, y+1)
+	c.unwide(c.index(x, y))
+	if x+n < c.w {
+		// This wide rune would be cut in half by the right edge
+		c.unwide(c.index(c.w-n, y))
+	}
+	row := c.row(y)
+	copy(row[x+n:], row[x:])
+	for i := x; i < x+n; i++ {
+		row[i] = blank
+	}
+}
+
+// DeleteChars deletes n cells at x,y, like the "Delete Characters" terminal command.
+// The rest of the line is moved to the left, and blank cells are added at the end.
+func (c *Canvas) DeleteChars(x, y, n uint) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if x >= c.w || y >= c.h || n == 0 {
+		return
+	}
+	n = umin(n, c.w-x)
+	c.unwideEdges(y, y+1)
+	c.unwide(c.index(x, y))
+	if x+n < c.w {
+		c.unwide(c.index(x+n, y))
+	}
+	row := c.row(y)
+	copy(row[x:], row[x+n:])
+	for i := c.w - n; i < c.w; i++ {
+		row[i] = blank
+	}
+}
+
+// EraseChars replaces n cells at x,y with blank cells, like the "Erase Characters"
+// terminal command. The rest of the line is not moved.
+func (c *Canvas) EraseChars(x, y, n uint) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if x >= c.w || y >= c.h || n == 0 {
+		return
+	}
+	n = umin(n, c.w-x)
+	c.unwide(c.index(x, y))
+	c.unwide(c.index(x+n-1, y))
+	row := c.row(y)
+	for i := x; i < x+n; i++ {
+		row[i] = blank
+	}
+}
+
+// Resize resizes the canvas to the current terminal size, if it has changed.
+// The contents are kept, anchored to the corner set with SetAnchor (TopLeft by default),
+// and the next Draw repaints the whole screen.
 func (c *Canvas) Resize() {
-	w, h := MustTermSize()
+	if c.offscreen || c.root != nil {
+		return
+	}
+	c.ResizeTo(MustTermSize())
+}
+
+// ResizeTo resizes the canvas to the given size. The contents are kept, anchored
+// to the corner set with SetAnchor, and the next Draw repaints the whole screen.
+// Views of the canvas should not be used after it has been resized.
+// Returns true if the size was changed.
+func (c *Canvas) ResizeTo(w, h uint) bool {
+	if c.root != nil {
+		return false
+	}
 	c.mut.Lock()
-	if (w != c.w) || (h != c.h) {
-		// Resize to the new size
-		c.w = w
-		c.h = h
-		c.chars = make([]ColorRune, w*h)
-		c.mut = &sync.RWMutex{}
+	defer c.mut.Unlock()
+	if w == c.w && h == c.h {
+		return false
+	}
+	chars := make([]ColorRune, w*h)
+	for i := range chars {
+		chars[i].fg = defaultID
+		chars[i].bg = defaultBackgroundID
+	}
+	// The position of the old contents within the new canvas
+	dx, dy := 0, 0
+	if c.anchor == TopRight || c.anchor == BottomRight {
+		dx = int(w) - int(c.w)
+	}
+	if c.anchor == BottomLeft || c.anchor == BottomRight {
+		dy = int(h) - int(c.h)
 	}
+	// The part of the old contents that fits
+	sx0, sx1 := imax(0, -dx), imin(int(c.w), int(w)-dx)
+	sy0, sy1 := imax(0, -dy), imin(int(c.h), int(h)-dy)
+	for sy := sy0; sx0 < sx1 && sy < sy1; sy++ {
+		src := c.chars[sy*int(c.w) : (sy+1)*int(c.w)]
+		dst := chars[(sy+dy)*int(w) : (sy+dy+1)*int(w)]
+		left, right := sx0+dx, sx1+dx-1
+		copy(dst[left:right+1], src[sx0:sx1])
+		// Replace wide runes that are cut in half by the edges with spaces
+		if dst[left].r == wideContinuation {
+			dst[left].r = ' '
+		}
+		if sx1 < int(c.w) && src[sx1].r == wideContinuation {
+			dst[right].r, dst[right].text = ' ', 0
+		}
+	}
+	c.chars = chars
+	c.w, c.h, c.stride = w, h, w
+	c.repaint = true
+	c.compactStrings()
+	return true
+}
+
+// SetAnchor sets the corner that the contents stay in when the canvas is resized
+func (c *Canvas) SetAnchor(anchor Anchor) {
+	c.mut.Lock()
+	c.anchor = anchor
 	c.mut.Unlock()
 }
 
 // Check if the canvas was resized, and adjust values accordingly.
-// Returns a new canvas, or nil.
+// Returns a resized copy of the canvas, with the contents kept like ResizeTo does,
+// or nil if the size of the terminal has not changed.
+//
+// Deprecated: Use Resize or WatchResize, which resize the canvas itself.
 func (c *Canvas) Resized() *Canvas {
-	w, h := MustTermSize()
-	if (w != c.w) || (h != c.h) {
-		// The terminal was resized!
-		oldc := c
-
-		nc := &Canvas{}
-		nc.w = w
-		nc.h = h
-		nc.chars = make([]ColorRune, w*h)
-		nc.mut = &sync.RWMutex{}
-
-		nc.mut.Lock()
-		c.mut.Lock()
-		defer c.mut.Unlock()
-		defer nc.mut.Unlock()
-	OUT:
-		// Plot in the old characters
-		for y := uint(0); y < umin(oldc.h, h); y++ {
-			for x := uint(0); x < umin(oldc.w, w); x++ {
-				oldIndex := y*oldc.w + x
-				index := y*nc.w + x
-				if oldIndex > index {
-					break OUT
-				}
-				// Copy over old characters, and mark them as not drawn
-				cr := oldc.chars[oldIndex]
-				cr.drawn = false
-				nc.chars[index] = cr
-			}
-		}
-		// Return the new canvas
-		return nc
+	if c.offscreen || c.root != nil {
+		return nil
+	}
+	nc := c.Copy()
+	if !nc.ResizeTo(MustTermSize()) {
+		return nil
 	}
-	return nil
+	return &nc
 }
@@ -0,0 +1,468 @@
+package vt100
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCanvasWriter(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 20, 4)
+	c.Write(2, 1, Red, BackgroundBlue, "hello")
+	c.Draw()
+	out := buf.String()
+	if !strings.Contains(out, "hello") {
+		t.Errorf("expected the drawn output to contain the text, got %q", out)
+	}
+	if !strings.Contains(out, "\033[?25l") {
+		t.Errorf("expected the cursor to be hidden, got %q", out)
+	}
+	if c.Terminal().Writer() != &buf {
+		t.Error("expected the canvas terminal to write to the given buffer")
+	}
+}
+
+func TestOffscreenCanvas(t *testing.T) {
+	c := NewOffscreenCanvas(5, 2)
+	c.WriteString(1, 0, Blue, BackgroundDefault, "abc")
+	c.PlotColor(0, 1, Red, 'x')
+	c.SetShowCursor(true)
+	c.Draw()
+	if got, want := c.String(), " abc \nx    \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := c.ToImage(); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	screen := NewCanvasWriter(&buf, 4, 3)
+	screen.Blit(c, 1, 1)
+	if got, want := screen.String(), "    \n  ab\n x  \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDrawOnlyChangedCells(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 80, 25)
+	c.Write(0, 0, White, BackgroundBlue, "status")
+	c.Draw()
+	buf.Reset()
+
+	// Nothing has changed, nothing should be written
+	c.Draw()
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+
+	// A single changed cell should result in a cursor movement and that cell only
+	c.PlotColor(40, 12, Red, '!')
+	c.Draw()
+	out := buf.String()
+	if !strings.HasPrefix(out, "\033[13;41H") || !strings.Contains(out, "!") {
+		t.Errorf("expected a cursor movement to the changed cell, got %q", out)
+	}
+	if len(out) > 40 {
+		t.Errorf("expected a short partial update, got %d bytes: %q", len(out), out)
+	}
+
+	// Redraw should repaint every cell
+	buf.Reset()
+	c.Redraw()
+	if buf.Len() < 80*25 {
+		t.Errorf("expected a full repaint, got %d bytes", buf.Len())
+	}
+}
+
+func TestDrawMinimalAttributeChanges(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 4, 1)
+	buf.Reset()
+	c.WriteRune(0, 0, Red.Bright(), BackgroundBlue, 'a')
+	c.WriteRune(1, 0, Red, BackgroundBlue, 'b')
+	c.WriteRune(2, 0, Green, BackgroundBlue, 'c')
+	c.WriteRune(3, 0, Green, BackgroundBlue, 'd')
+	c.Draw()
+	want := "\033[1;1H\033[0;1;31;44ma\033[22mb\033[32mcd\033[0m"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func BenchmarkCanvasRedraw(b *testing.B) {
+	c := NewCanvasWriter(io.Discard, 300, 100)
+	colors := []AttributeColor{Red, Green, Blue, Yellow.Bright()}
+	line := strings.Repeat("x", 300)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		for y := uint(0); y < 100; y++ {
+			c.WriteString(0, y, colors[(n+int(y))%len(colors)], BackgroundBlack, line)
+		}
+		c.Redraw()
+	}
+}
+
+func TestWideRunes(t *testing.T) {
+	c := NewOffscreenCanvas(6, 2)
+	c.WriteString(0, 0, Default, BackgroundDefault, "日本e\u0301")
+	if got, want := c.String(), "日本e\u0301 \n      \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Overwriting the right half of a wide rune replaces the left half with a space
+	c.Plot(1, 0, 'x')
+	// A wide rune that does not fit at the end of the line is placed on the next line
+	c.WriteString(5, 0, Default, BackgroundDefault, "語")
+	if got, want := c.String(), " x本e\u0301 \n語    \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if r, _ := c.At(3, 0); r != '本' {
+		t.Errorf("expected the wide rune at both of its cells, got %q", r)
+	}
+
+	var buf bytes.Buffer
+	screen := NewCanvasWriter(&buf, 6, 1)
+	screen.WriteString(0, 0, Default, BackgroundDefault, "ab日c")
+	screen.Draw()
+	buf.Reset()
+	screen.WriteString(2, 0, Default, BackgroundDefault, "本")
+	screen.Draw()
+	if got := buf.String(); !strings.HasPrefix(got, "\033[1;3H") || !strings.Contains(got, "本") || strings.Contains(got, "c") {
+		t.Errorf("expected only the wide rune to be redrawn, got %q", got)
+	}
+}
+
+func TestGraphemeClusters(t *testing.T) {
+	for _, tc := range []struct {
+		s     string
+		want  []string
+		width int
+	}{
+		{"e\u0301x", []string{"e\u0301", "x"}, 2},
+		{"\r\nx", []string{"\r\n", "x"}, 2},
+		{"\U0001F1F3\U0001F1F4\U0001F1F8", []string{"\U0001F1F3\U0001F1F4", "\U0001F1F8"}, 3},
+		{"\U0001F468\u200d\U0001F469\u200d\U0001F467!", []string{"\U0001F468\u200d\U0001F469\u200d\U0001F467", "!"}, 3},
+		{"\U0001F44D\U0001F3FD❤\uFE0F", []string{"\U0001F44D\U0001F3FD", "❤\uFE0F"}, 4},
+		{"\u1100\u1161\u11A8가", []string{"\u1100\u1161\u11A8", "가"}, 4},
+	} {
+		var got []string
+		for s := tc.s; s != ""; {
+			var cluster string
+			cluster, s = nextGrapheme(s)
+			got = append(got, cluster)
+		}
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") {
+			t.Errorf("%+q: got clusters %+q, want %+q", tc.s, got, tc.want)
+		}
+		if w := StringWidth(tc.s); w != tc.width {
+			t.Errorf("%+q: got width %d, want %d", tc.s, w, tc.width)
+		}
+	}
+
+	c := NewOffscreenCanvas(5, 1)
+	c.WriteString(0, 0, Default, BackgroundDefault, "\U0001F1F3\U0001F1F4❤\uFE0Fa")
+	if got, want := c.String(), "\U0001F1F3\U0001F1F4❤\uFE0Fa\n"; got != want {
+		t.Errorf("got %+q, want %+q", got, want)
+	}
+}
+
+func TestRunewise(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 6, 1)
+	c.SetRunewise(true)
+	c.WriteString(0, 0, Default, BackgroundDefault, "e\u0301語\U0001F468\u200d\U0001F469!")
+	c.Draw()
+	out := buf.String()
+	if strings.ContainsRune(out, utf8.RuneError) {
+		t.Errorf("expected no replacement characters, got %+q", out)
+	}
+	for _, cluster := range []string{"e\u0301", "語", "\U0001F468\u200d\U0001F469", "!"} {
+		if strings.Count(out, cluster) != 1 {
+			t.Errorf("expected %+q to be drawn once, got %+q", cluster, out)
+		}
+	}
+}
+
+func TestSub(t *testing.T) {
+	c := NewOffscreenCanvas(6, 3)
+	v := c.Sub(1, 1, 4, 2)
+	if w, h := v.Size(); w != 4 || h != 2 {
+		t.Fatalf("expected a 4x2 view, got %dx%d", w, h)
+	}
+	// Writes are translated and clipped to the view
+	v.WriteString(2, 0, Default, BackgroundDefault, "abc")
+	v.Plot(4, 1, 'x')
+	v.WriteRune(0, 5, Default, BackgroundDefault, 'y')
+	// Views can be nested
+	v.Sub(1, 1, 10, 10).WriteString(0, 0, Default, BackgroundDefault, "語z")
+	if got, want := c.String(), "      \n   ab \n c語z \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := v.String(), "  ab\nc語z\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if r, _ := v.At(1, 1); r != '語' {
+		t.Errorf("expected the rune at 1,1 in the view to be 語, got %q", r)
+	}
+	v.Clear()
+	if got, want := c.String(), "      \n      \n      \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	screen := NewOffscreenCanvas(4, 2)
+	layers := NewLayers(screen)
+	background := layers.NewScreenLayer(0)
+	background.FillBackground(BackgroundBlue)
+	background.WriteString(0, 0, Default, BackgroundBlue, "....")
+	sprite := layers.NewLayer(2, 1, 1)
+	sprite.WriteString(0, 0, Red, None, "@")
+	sprite.Move(1, 1)
+	layers.Flatten()
+	if got, want := screen.String(), "....\n @  \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The sprite has no background color of its own, and the cell next to it is transparent
+	blue := internBackground(BackgroundBlue)
+	if cr := screen.chars[screen.index(1, 1)]; cr.bg != blue || cr.fg != internColor(Red) {
+		t.Errorf("expected a red sprite on the blue background")
+	}
+	if cr := screen.chars[screen.index(2, 1)]; cr.bg != blue {
+		t.Errorf("expected the transparent cell to show the background")
+	}
+	// Moving the sprite does not destroy what is underneath
+	sprite.Move(3, 0)
+	layers.Flatten()
+	if got, want := screen.String(), "...@\n    \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	sprite.SetZ(-1)
+	layers.Flatten()
+	if got, want := screen.String(), "....\n    \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	sprite.SetZ(1)
+	background.Hide()
+	layers.Flatten()
+	if got, want := screen.String(), "   @\n    \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAlternateScreen(t *testing.T) {
+	var buf bytes.Buffer
+	term := NewTerminal(&buf)
+	term.UseAlternateScreen(true)
+	term.Init()
+	if got := buf.String(); !strings.HasPrefix(got, "\0337\033[?1049h") || strings.Contains(got, "\033c") {
+		t.Errorf("expected the cursor to be saved and the alternate screen to be entered, got %q", got)
+	}
+	buf.Reset()
+	term.Close()
+	if got := buf.String(); !strings.HasSuffix(got, "\033[?1049l\0338") {
+		t.Errorf("expected the alternate screen to be left and the cursor to be restored, got %q", got)
+	}
+}
+
+func TestResizeTo(t *testing.T) {
+	c := NewOffscreenCanvas(4, 2)
+	c.WriteString(0, 0, Default, BackgroundDefault, "a語b")
+	c.WriteString(0, 1, Default, BackgroundDefault, "cdef")
+	mut := c.mut
+	if !c.ResizeTo(5, 3) {
+		t.Fatal("expected the canvas to be resized")
+	}
+	if got, want := c.String(), "a語b \ncdef \n     \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if c.mut != mut {
+		t.Error("expected the mutex to be kept")
+	}
+	// The wide rune is cut in half by the left edge
+	c.SetAnchor(TopRight)
+	c.ResizeTo(3, 2)
+	if got, want := c.String(), " b \nef \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if c.ResizeTo(3, 2) {
+		t.Error("expected the canvas to keep its size")
+	}
+}
+
+func TestResizeWhileWriting(t *testing.T) {
+	c := NewOffscreenCanvas(40, 20)
+	src := NewOffscreenCanvas(8, 2)
+	src.WriteString(0, 0, Red, BackgroundBlue, "語語語語")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			if i%2 == 0 {
+				c.ResizeTo(3, 2)
+			} else {
+				c.ResizeTo(40, 20)
+			}
+		}
+	}()
+	// The canvas may shrink between checking x,y and writing to the cell
+	for i := uint(0); i < 200; i++ {
+		x, y := 39-i%40, 19-i%20
+		c.Plot(x, y, 'a')
+		c.PlotColor(x, y, Red, 'b')
+		c.WriteRune(x, y, Red, BackgroundBlue, 'c')
+		c.WriteRuneB(x, y, Red, BackgroundBlue, 'd')
+		c.WriteRunesB(x, y, Red, BackgroundBlue, 'e', 5)
+		c.WriteBackground(x, y, BackgroundBlue)
+		c.WriteBackgroundAddRuneIfEmpty(x, y, BackgroundBlue, 'f')
+		c.WriteString(x, y, Red, BackgroundBlue, "gh語")
+		c.InsertChars(x, y, 2)
+		c.DeleteChars(x, y, 2)
+		c.EraseChars(x, y, 2)
+		c.Blit(src, x, y)
+		c.Size()
+	}
+	wg.Wait()
+}
+
+func TestInsertAndDelete(t *testing.T) {
+	c := NewOffscreenCanvas(5, 3)
+	c.WriteString(0, 0, Default, BackgroundDefault, "abcde")
+	c.WriteString(0, 1, Default, BackgroundDefault, "fghij")
+	c.WriteString(0, 2, Default, BackgroundDefault, "a語bc")
+	c.InsertChars(1, 0, 2)
+	c.DeleteChars(0, 1, 1)
+	c.EraseChars(3, 1, 9)
+	if got, want := c.String(), "a  bc\nghi  \na語bc\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Wide runes that are cut in half are replaced with spaces
+	c.InsertChars(0, 2, 3)
+	if got, want := c.String(), "a  bc\nghi  \n   a \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	c.ScrollUp(1)
+	if got, want := c.String(), "ghi  \n   a \n     \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	c.InsertLines(1, 1)
+	if got, want := c.String(), "ghi  \n     \n   a \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	c.Sub(2, 0, 3, 3).ScrollDown(1)
+	c.DeleteLines(0, 1)
+	if got, want := c.String(), "  i  \n     \n     \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := IL(2)+DCH(1)+SU(3)+CHA(0)+VPA(4)+DECSTR(), "\033[2L\033[1P\033[3S\033[1G\033[5d\033[!p"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDrawDownsampled(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 4, 1)
+	c.WriteString(0, 0, AttributeColor{38, 2, 255, 0, 0}, BackgroundDefault, "ab")
+	c.Draw()
+	if out := buf.String(); !strings.Contains(out, "38;2;255;0;0") {
+		t.Errorf("expected the 24-bit color to be kept, got %q", out)
+	}
+	c.Terminal().SetColorLevel(ColorLevel256)
+	buf.Reset()
+	c.Redraw()
+	if out := buf.String(); !strings.Contains(out, "38;5;196") || strings.Contains(out, "38;2") {
+		t.Errorf("expected a 256 color palette color, got %q", out)
+	}
+}
+
+func TestDrawTextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 3, 1)
+	c.WriteString(0, 0, Italic.Combine(CurlyUnderline).Combine(Red.UnderlineColor()), BackgroundDefault, "a")
+	c.WriteString(1, 0, Italic.Combine(DottedUnderline).Combine(Red.UnderlineColor()), BackgroundDefault, "b")
+	c.WriteString(2, 0, Strikethrough.Combine(Overline), BackgroundDefault, "c")
+	c.Draw()
+	if got, want := buf.String(), "\033[1;1H\033[0;3;4:3;58;5;1ma\033[4:4mb\033[0;9;53mc\033[0m"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The test terminfo entry has Smulx, but not sitm, smxx, Smol or Setulc
+	ti, err := ParseTerminfo(testTerminfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Terminal().SetTerminfo(ti)
+	buf.Reset()
+	c.Redraw()
+	if got, want := buf.String(), "\033[1;1H\033[0;4:3ma\033[4:4mb\033[0mc"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteLink(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 6, 2)
+	c.WriteString(0, 0, Default, BackgroundDefault, "a")
+	c.WriteLink(1, 0, Default, BackgroundDefault, "link", "https://example.com/\033x")
+	c.Draw()
+	if got, want := buf.String(), "a\033]8;;https://example.com/x\033\\link\033]8;;\033\\ "; !strings.Contains(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := c.String(), "alink \n      \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Overwriting a part of the link only redraws that part, and ends the link before it
+	buf.Reset()
+	c.WriteString(3, 0, Default, BackgroundDefault, "n")
+	c.Draw()
+	if got, want := buf.String(), "n"; !strings.HasSuffix(got, want) || strings.Contains(got, "\033]8") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// A link that continues on the next line is kept open while the cursor is moved
+	buf.Reset()
+	c.WriteLink(4, 0, Default, BackgroundDefault, "next", "https://example.org")
+	c.Draw()
+	if got := buf.String(); strings.Count(got, "\033]8;;https://example.org\033\\") != 1 || !strings.HasSuffix(got, "\033]8;;\033\\") {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+func TestCellStrings(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCanvasWriter(&buf, 3, 1)
+	for i := 0; i < 100; i++ {
+		c.Clear()
+		c.WriteLink(0, 0, Default, BackgroundDefault, "a", fmt.Sprintf("https://example.com/%d", i))
+		c.WriteString(1, 0, Default, BackgroundDefault, fmt.Sprintf("e\u0301%d", i%10))
+		c.Draw()
+	}
+	// The URLs and texts that are no longer used are removed when the canvas is cleared
+	if n := len(c.links.strings) + len(c.texts.strings); n > 2*(len(c.chars)+len(c.oldchars)+1) {
+		t.Errorf("expected the unused strings to be removed, there are %d", n)
+	}
+	buf.Reset()
+	c.Clear()
+	c.WriteLink(0, 0, Default, BackgroundDefault, "a", "https://example.com/99")
+	c.WriteString(1, 0, Default, BackgroundDefault, "e\u03019")
+	c.Draw()
+	if got := buf.String(); got != "" {
+		t.Errorf("expected nothing to be drawn, got %q", got)
+	}
+
+	// Blitting looks up the texts and URLs of the source in the canvas that is written to
+	src := NewOffscreenCanvas(2, 1)
+	src.WriteLink(0, 0, Default, BackgroundDefault, "o\u0308", "https://example.org")
+	c.Blit(src, 1, 0)
+	if got, want := c.String(), "ao\u0308 \n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	c.Draw()
+	if got, want := buf.String(), "\033]8;;https://example.org\033\\o\u0308"; !strings.Contains(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
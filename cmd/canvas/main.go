@@ -5,8 +5,11 @@ import (
 )
 
 func main() {
-	// Initialize vt100 terminal settings
-	vt100.Init()
+	// Initialize vt100 terminal settings, and restore them when done,
+	// even if the program panics or is interrupted
+	s := vt100.Start()
+	defer s.Close()
+	defer s.Recover()
 
 	// Prepare a canvas
 	c := vt100.NewCanvas()
@@ -26,7 +29,4 @@ func main() {
 
 	// Wait for a keypress
 	vt100.WaitForKey()
-
-	// Reset the vt100 terminal settings
-	vt100.Close()
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/xyproto/vt100"
+)
+
+// Print the key presses, mouse events, pasted text and resizes, until q or Ctrl-C is pressed
+func main() {
+	tty, err := vt100.NewTTY()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer tty.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Print("Press q to exit\r\n")
+	loop := vt100.NewEventLoop(tty)
+	loop.EnableMouse(true)
+	loop.EnableBracketedPaste(true)
+	err = loop.Run(ctx, func(e vt100.Event) error {
+		switch e := e.(type) {
+		case vt100.KeyEvent:
+			if e.Rune == 'q' || (e.Rune == 'c' && e.Mods == vt100.ModCtrl) {
+				return vt100.ErrStop
+			}
+			fmt.Printf("key: %s\r\n", e)
+		case vt100.MouseEvent:
+			fmt.Printf("mouse: %+v\r\n", e)
+		case vt100.PasteEvent:
+			fmt.Printf("paste: %q\r\n", e.Text)
+		case vt100.ResizeEvent:
+			fmt.Printf("resize: %dx%d\r\n", e.W, e.H)
+		}
+		return nil
+	})
+	if err != nil && err != context.Canceled {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -1,12 +1,9 @@
 package main
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
-	"os"
-	"os/signal"
-	"sync"
-	"syscall"
 	"time"
 
 	"github.com/xyproto/vt100"
@@ -20,41 +17,16 @@ func main() {
 	}
 	defer tty.Close()
 
-	// Mutex used when the terminal is resized
-	resizeMut := &sync.RWMutex{}
-
 	var (
 		bob     = NewBob()
-		sigChan = make(chan os.Signal, 1)
 		bullets = make([]*Bullet, 0)
 		enemies = NewEnemies(7)
 	)
 
-	signal.Notify(sigChan, syscall.SIGWINCH)
-	go func() {
-		for range sigChan {
-			resizeMut.Lock()
-			// Create a new canvas, with the new size
-			nc := c.Resized()
-			if nc != nil {
-				c.Clear()
-				vt100.Clear()
-				c.Draw()
-				c = nc
-			}
-
-			// Inform all elements that the terminal was resized
-			// TODO: Use a slice of interfaces that can contain all elements
-			for _, bullet := range bullets {
-				bullet.Resize()
-			}
-			for _, enemy := range enemies {
-				enemy.Resize()
-			}
-			bob.Resize()
-			resizeMut.Unlock()
-		}
-	}()
+	// Resize the canvas when the terminal is resized
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sizes := c.WatchResize(ctx)
 
 	vt100.Init()
 	defer vt100.Close()
@@ -74,11 +46,25 @@ func main() {
 
 	for running {
 
+		select {
+		case <-sizes:
+			vt100.Clear()
+			// Inform all elements that the terminal was resized
+			// TODO: Use a slice of interfaces that can contain all elements
+			for _, bullet := range bullets {
+				bullet.Resize()
+			}
+			for _, enemy := range enemies {
+				enemy.Resize()
+			}
+			bob.Resize()
+		default:
+		}
+
 		// Draw elements in their new positions
 		c.Clear()
 		//c.Draw()
 
-		resizeMut.RLock()
 		for _, bullet := range bullets {
 			bullet.Draw(c)
 		}
@@ -86,7 +72,6 @@ func main() {
 			enemy.Draw(c)
 		}
 		bob.Draw(c)
-		resizeMut.RUnlock()
 
 		//vt100.Clear()
 
@@ -109,27 +94,17 @@ func main() {
 		key = tty.Key()
 		switch key {
 		case 253: // Up
-			resizeMut.Lock()
 			moved = bob.Up(c)
-			resizeMut.Unlock()
 		case 255: // Down
-			resizeMut.Lock()
 			moved = bob.Down(c)
-			resizeMut.Unlock()
 		case 254: // Right
-			resizeMut.Lock()
 			moved = bob.Right(c)
-			resizeMut.Unlock()
 		case 252: // Left
-			resizeMut.Lock()
 			moved = bob.Left(c)
-			resizeMut.Unlock()
 		case 27, 113: // ESC or q
 			running = false
 		case 32: // Space
-			resizeMut.Lock()
 			bob.ToggleColor()
-			resizeMut.Unlock()
 			// Check if the place to the right is available
 			r, err := c.At(uint(bob.x+1), uint(bob.y))
 			if err != nil {
@@ -142,9 +117,7 @@ func main() {
 			}
 		case 97: // a
 			// Write the canvas characters to file
-			resizeMut.RLock()
 			b := []byte(c.String())
-			resizeMut.RUnlock()
 			err := ioutil.WriteFile("canvas.txt", b, 0644)
 			if err != nil {
 				log.Fatalln(err)
@@ -157,7 +130,6 @@ func main() {
 		//}
 
 		// Change state
-		resizeMut.Lock()
 		for _, bullet := range bullets {
 			bullet.Next(c)
 		}
@@ -167,7 +139,6 @@ func main() {
 		if moved {
 			bob.ToggleState()
 		}
-		resizeMut.Unlock()
 
 		// Erase all previous positions not occupied by current items
 		c.Plot(uint(bob.oldx), uint(bob.oldy), bobEraseChar)
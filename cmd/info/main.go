@@ -3,12 +3,18 @@ package main
 import (
 	"fmt"
 	"github.com/xyproto/vt100"
+	"strings"
 )
 
 func main() {
 	fmt.Println("Available VT100 commands:")
 	for _, command := range vt100.Commands() {
-		fmt.Println("\t" + command)
+		name := command.Name
+		if len(command.Params) > 0 {
+			name += " (" + strings.Join(command.Params, ", ") + ")"
+		}
+		fmt.Println("\t" + name)
+		fmt.Println("\t\t" + command.Description)
 	}
 	fmt.Println()
 	fmt.Println("Available VT100 colors:")
@@ -1,12 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/xyproto/vt100"
-	"os"
-	"os/signal"
-	"sync"
-	"syscall"
 	"time"
 	"unicode"
 )
@@ -34,31 +31,12 @@ func Menu(title, titleColor string, choices []string, selectionDelay time.Durati
 		panic(err)
 	}
 
-	// Mutex used when the terminal is resized
-	resizeMut := &sync.RWMutex{}
-
-	var (
-		menu    = NewMenuWidget(title, titleColor, choices, fg, hi, active, arrowColor, c.W(), c.H())
-		sigChan = make(chan os.Signal, 1)
-	)
-
-	signal.Notify(sigChan, syscall.SIGWINCH)
-	go func() {
-		for range sigChan {
-			resizeMut.Lock()
-			// Create a new canvas, with the new size
-			nc := c.Resized()
-			if nc != nil {
-				vt100.Clear()
-				c = nc
-				c.Redraw()
-			}
+	menu := NewMenuWidget(title, titleColor, choices, fg, hi, active, arrowColor, c.W(), c.H())
 
-			// Inform all elements that the terminal was resized
-			menu.Resize()
-			resizeMut.Unlock()
-		}
-	}()
+	// Resize the canvas when the terminal is resized
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sizes := c.WatchResize(ctx)
 
 	vt100.Init()
 	defer vt100.Close()
@@ -74,12 +52,19 @@ func Menu(title, titleColor string, choices []string, selectionDelay time.Durati
 
 	for running {
 
+		select {
+		case <-sizes:
+			vt100.Clear()
+			c.Redraw()
+			// Inform all elements that the terminal was resized
+			menu.Resize()
+		default:
+		}
+
 		// Draw elements in their new positions
 		//vt100.Clear()
 
-		resizeMut.RLock()
 		menu.Draw(c)
-		resizeMut.RUnlock()
 
 		// Update the canvas
 		c.Draw()
@@ -100,33 +85,21 @@ func Menu(title, titleColor string, choices []string, selectionDelay time.Durati
 		key := tty.Key()
 		switch key {
 		case 253, 252, 107, 16: // Up, left, k or ctrl-p
-			resizeMut.Lock()
 			menu.Up(c)
-			resizeMut.Unlock()
 		case 255, 254, 106, 14: // Down, right, j or ctrl-n
-			resizeMut.Lock()
 			menu.Down(c)
-			resizeMut.Unlock()
 		case 1: // Top, ctrl-a
-			resizeMut.Lock()
 			menu.SelectFirst()
-			resizeMut.Unlock()
 		case 5: // Bottom, ctrl-e
-			resizeMut.Lock()
 			menu.SelectLast()
-			resizeMut.Unlock()
 		case 27, 113: // ESC or q
 			running = false
 		case 32, 13: // Space or Return
-			resizeMut.Lock()
 			menu.Select()
-			resizeMut.Unlock()
 			running = false
 		case 48, 49, 50, 51, 52, 53, 54, 55, 56, 57: // 0 .. 9
 			number := uint(key - 48)
-			resizeMut.Lock()
 			menu.SelectIndex(number)
-			resizeMut.Unlock()
 		default:
 			letterNumber := 0
 			// Check if the key matches the first letter (a-z,A-Z) in the choices
@@ -161,9 +134,7 @@ func Menu(title, titleColor string, choices []string, selectionDelay time.Durati
 			// Choose the index for the letter that was pressed and found in the keymap, if found
 			for letter, index := range keymap {
 				if letter == r {
-					resizeMut.Lock()
 					menu.SelectIndex(uint(index))
-					resizeMut.Unlock()
 				}
 			}
 		}
@@ -177,9 +148,7 @@ func Menu(title, titleColor string, choices []string, selectionDelay time.Durati
 
 	if menu.Selected() >= 0 {
 		// Draw the selected item in a different color for a short while
-		resizeMut.Lock()
 		menu.SelectDraw(c)
-		resizeMut.Unlock()
 		c.Draw()
 		time.Sleep(selectionDelay)
 	}
@@ -1,10 +1,7 @@
 package main
 
 import (
-	"os"
-	"os/signal"
-	"sync"
-	"syscall"
+	"context"
 	"time"
 
 	"github.com/xyproto/vt100"
@@ -90,34 +87,10 @@ func main() {
 	bob.x = 10
 	bob.y = 10
 
-	var draw sync.RWMutex
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGWINCH)
-	go func() {
-		for range sigChan {
-			// Terminal was resized
-
-			// Prepare to resize the canvas
-			draw.Lock()
-
-			// Clear the screen after the resize
-			vt100.Clear()
-
-			// Create a new canvas, with the new size
-			nc := c.Resized()
-			if nc != nil {
-				c.Clear()
-				c.Draw()
-				c = nc
-			}
-			// Clear again, for good measure
-			vt100.Clear()
-			// Redraw the characters
-			c.Redraw()
-			// Done
-			draw.Unlock()
-		}
-	}()
+	// Resize the canvas when the terminal is resized
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sizes := c.WatchResize(ctx)
 
 	vt100.Clear()
 	vt100.ShowCursor(false)
@@ -126,17 +99,20 @@ func main() {
 	running := true
 	for running {
 
+		select {
+		case <-sizes:
+			// Clear the screen after the resize, the canvas is repainted when it is drawn
+			vt100.Clear()
+		default:
+		}
+
 		//vt100.Clear()
 
 		// Draw elements in their new positions
-		draw.Lock()
 		bob.Draw(c)
-		draw.Unlock()
 
 		// Update the canvas
-		draw.Lock()
 		c.Draw()
-		draw.Unlock()
 
 		// Wait a bit
 		time.Sleep(time.Millisecond * 10)
@@ -147,7 +123,6 @@ func main() {
 		moved := false
 
 		// Handle events
-		draw.Lock()
 		switch tty.Key() {
 		case 253: // Up
 			moved = bob.Up(c)
@@ -163,15 +138,12 @@ func main() {
 		case 32: // Space
 			bob.ToggleColor()
 		}
-		draw.Unlock()
 
 		if moved {
 			bob.ToggleState()
 
 			// Erase elements at their old positions
-			draw.Lock()
 			c.Plot(uint(oldx), uint(oldy), ' ')
-			draw.Unlock()
 		}
 	}
 	tty.Close()
@@ -1,13 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"os"
-	"os/signal"
-	"sync"
-	"syscall"
 	"time"
 
 	"github.com/xyproto/vt100"
@@ -27,12 +24,8 @@ func main() {
 
 	vt100.EchoOff()
 
-	// Mutex used when the terminal is resized
-	resizeMut := &sync.RWMutex{}
-
 	var (
 		bob         = NewBob()
-		sigChan     = make(chan os.Signal, 1)
 		evilGobbler = NewEvilGobbler()
 		gobblers    = NewGobblers(10)
 		bullets     = make([]*Bullet, 0)
@@ -41,35 +34,10 @@ func main() {
 		highScore   = uint(0)
 	)
 
-	signal.Notify(sigChan, syscall.SIGWINCH)
-	go func() {
-		for range sigChan {
-			resizeMut.Lock()
-			// Create a new canvas, with the new size
-			nc := c.Resized()
-			if nc != nil {
-				c.Clear()
-				vt100.Clear()
-				c.Draw()
-				c = nc
-			}
-
-			// Inform all elements that the terminal was resized
-			// TODO: Use a slice of interfaces that can contain all elements
-			for _, bullet := range bullets {
-				bullet.Resize()
-			}
-			for _, enemy := range enemies {
-				enemy.Resize()
-			}
-			for _, gobbler := range gobblers {
-				gobbler.Resize()
-			}
-			bob.Resize()
-			evilGobbler.Resize()
-			resizeMut.Unlock()
-		}
-	}()
+	// Resize the canvas when the terminal is resized
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sizes := c.WatchResize(ctx)
 
 	vt100.Init()
 	defer vt100.Close()
@@ -89,11 +57,29 @@ func main() {
 
 	for running {
 
+		select {
+		case <-sizes:
+			vt100.Clear()
+			// Inform all elements that the terminal was resized
+			// TODO: Use a slice of interfaces that can contain all elements
+			for _, bullet := range bullets {
+				bullet.Resize()
+			}
+			for _, enemy := range enemies {
+				enemy.Resize()
+			}
+			for _, gobbler := range gobblers {
+				gobbler.Resize()
+			}
+			bob.Resize()
+			evilGobbler.Resize()
+		default:
+		}
+
 		// Draw elements in their new positions
 		c.Clear()
 		//c.Draw()
 
-		resizeMut.RLock()
 		for _, bullet := range bullets {
 			bullet.Draw(c)
 		}
@@ -106,7 +92,6 @@ func main() {
 		}
 		bob.Draw(c)
 		c.Write(5, 1, vt100.LightRed, vt100.BackgroundDefault, statusText)
-		resizeMut.RUnlock()
 
 		//vt100.Clear()
 
@@ -129,21 +114,13 @@ func main() {
 		key = tty.Key()
 		switch key {
 		case 253, 119: // Up or w
-			resizeMut.Lock()
 			moved = bob.Up(c)
-			resizeMut.Unlock()
 		case 255, 115: // Down or s
-			resizeMut.Lock()
 			moved = bob.Down(c)
-			resizeMut.Unlock()
 		case 254, 100: // Right or d
-			resizeMut.Lock()
 			moved = bob.Right(c)
-			resizeMut.Unlock()
 		case 252, 97: // Left or a
-			resizeMut.Lock()
 			moved = bob.Left(c)
-			resizeMut.Unlock()
 		case 27, 113: // ESC or q
 			running = false
 		case 32: // Space
@@ -159,9 +136,7 @@ func main() {
 			}
 		case 112: // p
 			// Write the canvas characters to file
-			resizeMut.RLock()
 			b := []byte(c.String())
-			resizeMut.RUnlock()
 			err := ioutil.WriteFile("canvas.txt", b, 0644)
 			if err != nil {
 				log.Fatalln(err)
@@ -175,7 +150,6 @@ func main() {
 
 		if !paused {
 			// Change state
-			resizeMut.Lock()
 			for _, bullet := range bullets {
 				bullet.Next(c)
 			}
@@ -189,7 +163,6 @@ func main() {
 			if moved {
 				bob.ToggleState()
 			}
-			resizeMut.Unlock()
 		}
 
 		// Erase all previous positions not occupied by current items
@@ -1,12 +1,9 @@
 package main
 
 import (
+	"context"
+
 	"github.com/xyproto/vt100"
-	"os"
-	"os/signal"
-	"sync"
-	"syscall"
-	"time"
 )
 
 func draw(c *vt100.Canvas) {
@@ -53,35 +50,12 @@ func draw(c *vt100.Canvas) {
 }
 
 func main() {
-	var (
-		c = vt100.NewCanvas()
-
-		// Channel for terminal signals
-		sigChan = make(chan os.Signal, 1)
-
-		// Mutex used when the terminal is resized
-		resizeMut = &sync.RWMutex{}
-	)
-
-	signal.Notify(sigChan, syscall.SIGWINCH)
-	go func() {
-		for range sigChan {
-			resizeMut.Lock()
-			vt100.Close()
-
-			// Sleeping here is a bit dirty, but it works
-			time.Sleep(100 * time.Millisecond)
-			//vt100.Reset()
+	c := vt100.NewCanvas()
 
-			vt100.Init()
-			c = vt100.NewCanvas()
-			draw(c)
-
-			resizeMut.Unlock()
-		}
-	}()
-
-	resizeMut.Lock()
+	// Resize the canvas when the terminal is resized
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sizes := c.WatchResize(ctx)
 
 	vt100.Init()
 	defer vt100.Close()
@@ -89,7 +63,13 @@ func main() {
 	c.Clear()
 	draw(c)
 
-	resizeMut.Unlock()
+	// Draw the widgets again, for the new size
+	go func() {
+		for range sizes {
+			c.Clear()
+			draw(c)
+		}
+	}()
 
 	vt100.WaitForKey()
 }
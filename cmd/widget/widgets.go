@@ -26,23 +26,23 @@ func (t *Theme) DrawBox(c *vt100.Canvas, r *Box, extrude bool) *Rect {
 		FG1 = t.BoxDark
 		FG2 = t.BoxLight
 	}
-	c.WriteRune(x, y, FG1, t.BoxBackground, t.TL)
-	//c.Write(x+1, y, FG1, t.BoxBackground, RepeatRune(t.HT, width-2))
-	for i := x + 1; i < x+(width-1); i++ {
-		c.WriteRune(i, y, FG1, t.BoxBackground, t.HT)
+	// Draw the box in its own view, with 0,0 as the upper left corner
+	v := c.Sub(x, y, width, height)
+	v.WriteRune(0, 0, FG1, t.BoxBackground, t.TL)
+	for i := uint(1); i < width-1; i++ {
+		v.WriteRune(i, 0, FG1, t.BoxBackground, t.HT)
 	}
-	c.WriteRune(x+width-1, y, FG1, t.BoxBackground, t.TR)
-	for i := y + 1; i < y+height; i++ {
-		c.WriteRune(x, i, FG1, t.BoxBackground, t.VL)
-		c.Write(x+1, i, FG1, t.BoxBackground, RepeatRune(' ', width-2))
-		c.WriteRune(x+width-1, i, FG2, t.BoxBackground, t.VR)
+	v.WriteRune(width-1, 0, FG1, t.BoxBackground, t.TR)
+	for i := uint(1); i < height; i++ {
+		v.WriteRune(0, i, FG1, t.BoxBackground, t.VL)
+		v.Write(1, i, FG1, t.BoxBackground, RepeatRune(' ', width-2))
+		v.WriteRune(width-1, i, FG2, t.BoxBackground, t.VR)
 	}
-	c.WriteRune(x, y+height-1, FG1, t.BoxBackground, t.BL)
-	for i := x + 1; i < x+(width-1); i++ {
-		c.WriteRune(i, y+height-1, FG2, t.BoxBackground, t.HB)
+	v.WriteRune(0, height-1, FG1, t.BoxBackground, t.BL)
+	for i := uint(1); i < width-1; i++ {
+		v.WriteRune(i, height-1, FG2, t.BoxBackground, t.HB)
 	}
-	//c.Write(x+1, y+height-1, FG2, t.BoxBackground, RepeatRune(t.HB, width-2))
-	c.WriteRune(x+width-1, y+height-1, FG2, t.BoxBackground, t.BR)
+	v.WriteRune(width-1, height-1, FG2, t.BoxBackground, t.BR)
 	return &Rect{int(x), int(y), int(width), int(height)}
 }
 
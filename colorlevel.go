@@ -0,0 +1,277 @@
+package vt100
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// ColorLevel is how many colors a terminal can show
+type ColorLevel int
+
+const (
+	ColorLevelNone ColorLevel = iota // no colors, only attributes like bright and reverse
+	ColorLevel16                     // the 8 basic colors and their bright variants
+	ColorLevel256                    // the xterm 256 color palette
+	ColorLevelTrue                   // 24-bit "true color"
+)
+
+// String returns the name of the color level
+func (level ColorLevel) String() string {
+	switch level {
+	case ColorLevelNone:
+		return "monochrome"
+	case ColorLevel16:
+		return "16 colors"
+	case ColorLevel256:
+		return "256 colors"
+	default:
+		return "true color"
+	}
+}
+
+// DetectColorLevel returns the color level of the terminal that the package-level
+// functions are using, as found by looking at $COLORTERM, $TERM and terminfo
+func DetectColorLevel() ColorLevel {
+	return stdoutTerminal.ColorLevel()
+}
+
+// SetColorLevel sets the color level of the terminal that the package-level functions
+// are using, instead of detecting it. The colors that are output by AttributeColor.String
+// and by canvases that draw to stdout are converted to this level.
+func SetColorLevel(level ColorLevel) {
+	stdoutTerminal.SetColorLevel(level)
+}
+
+// detectColorLevel finds the color level from the environment and from the given
+// terminfo entry, which may be nil
+func detectColorLevel(colorterm, term string, ti *Terminfo) ColorLevel {
+	colorterm = strings.ToLower(colorterm)
+	if colorterm == "truecolor" || colorterm == "24bit" {
+		return ColorLevelTrue
+	}
+	if ti != nil && (ti.Bools["Tc"] || ti.Bools["RGB"]) {
+		return ColorLevelTrue
+	}
+	if strings.Contains(term, "truecolor") || strings.Contains(term, "24bit") || strings.HasSuffix(term, "-direct") {
+		return ColorLevelTrue
+	}
+	if ti != nil {
+		colors := ti.Numbers["colors"]
+		switch {
+		case colors >= 1<<24:
+			return ColorLevelTrue
+		case colors >= 256:
+			return ColorLevel256
+		case colors >= 8:
+			return ColorLevel16
+		}
+		if !strings.Contains(term, "256color") {
+			return ColorLevelNone
+		}
+	}
+	switch {
+	case strings.Contains(term, "256color"):
+		return ColorLevel256
+	case term == "" || term == "dumb":
+		return ColorLevelNone
+	}
+	return ColorLevel16
+}
+
+// xterm256 returns the red, green and blue values of the given xterm palette color
+func xterm256(n byte) (r, g, b byte) {
+	switch {
+	case n < 16:
+		c := basicPalette[n]
+		return c[0], c[1], c[2]
+	case n < 232:
+		n -= 16
+		return cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]
+	}
+	gray := 8 + 10*(n-232)
+	return gray, gray, gray
+}
+
+// basicPalette is the xterm palette for the 16 basic colors
+var basicPalette = [16][3]byte{
+	{0x00, 0x00, 0x00}, {0xcd, 0x00, 0x00}, {0x00, 0xcd, 0x00}, {0xcd, 0xcd, 0x00},
+	{0x00, 0x00, 0xee}, {0xcd, 0x00, 0xcd}, {0x00, 0xcd, 0xcd}, {0xe5, 0xe5, 0xe5},
+	{0x7f, 0x7f, 0x7f}, {0xff, 0x00, 0x00}, {0x00, 0xff, 0x00}, {0xff, 0xff, 0x00},
+	{0x5c, 0x5c, 0xff}, {0xff, 0x00, 0xff}, {0x00, 0xff, 0xff}, {0xff, 0xff, 0xff},
+}
+
+// cubeLevels are the red, green and blue levels of the 6x6x6 color cube of the xterm palette
+var cubeLevels = [6]byte{0, 95, 135, 175, 215, 255}
+
+// lab is a color in the CIE L*a*b* color space, where the distance between two
+// colors is close to how different they look
+type lab struct {
+	l, a, b float64
+}
+
+// toLab converts an sRGB color to CIE L*a*b*, with the D65 white point
+func toLab(r, g, b byte) lab {
+	linear := func(c byte) float64 {
+		v := float64(c) / 255
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	lr, lg, lb := linear(r), linear(g), linear(b)
+	x := (0.4124*lr + 0.3576*lg + 0.1805*lb) / 0.95047
+	y := 0.2126*lr + 0.7152*lg + 0.0722*lb
+	z := (0.0193*lr + 0.1192*lg + 0.9505*lb) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// distance returns the squared distance between two colors
+func (c lab) distance(o lab) float64 {
+	dl, da, db := c.l-o.l, c.a-o.a, c.b-o.b
+	return dl*dl + da*da + db*db
+}
+
+// paletteLab is the xterm 256 color palette, in CIE L*a*b*
+var paletteLab = func() (palette [256]lab) {
+	for i := range palette {
+		palette[i] = toLab(xterm256(byte(i)))
+	}
+	return palette
+}()
+
+// nearestColor returns the palette color from first up to last that looks the most
+// like the given color
+func nearestColor(r, g, b byte, first, last int) byte {
+	c := toLab(r, g, b)
+	best, bestDistance := first, math.MaxFloat64
+	for i := first; i <= last; i++ {
+		if d := c.distance(paletteLab[i]); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return byte(best)
+}
+
+// downsampleCache holds the colors that have been converted to a lower color level
+var downsampleCache = struct {
+	mut    *sync.RWMutex
+	colors map[downsampleKey]sgrColor
+}{&sync.RWMutex{}, make(map[downsampleKey]sgrColor)}
+
+type downsampleKey struct {
+	sc    sgrColor
+	level ColorLevel
+}
+
+// downsample converts the color to the closest color that can be shown at the given level
+func (sc sgrColor) downsample(level ColorLevel) sgrColor {
+	if level >= ColorLevelTrue || sc == (sgrColor{}) {
+		return sc
+	}
+	if level == ColorLevelNone {
+		return sgrColor{}
+	}
+	extended := sc[0] == 38 || sc[0] == 48 || sc[0] == 58
+	if !extended || (level == ColorLevel256 && sc[1] == 5) {
+		return sc
+	}
+	key := downsampleKey{sc, level}
+	downsampleCache.mut.RLock()
+	converted, ok := downsampleCache.colors[key]
+	downsampleCache.mut.RUnlock()
+	if ok {
+		return converted
+	}
+	r, g, b := sc[2], sc[3], sc[4]
+	if sc[1] == 5 {
+		r, g, b = xterm256(sc[2])
+	}
+	if level == ColorLevel256 {
+		// The first 16 colors are often changed by the color theme of the terminal
+		converted = sgrColor{sc[0], 5, nearestColor(r, g, b, 16, 255)}
+	} else {
+		n := nearestColor(r, g, b, 0, 15)
+		if sc[1] == 5 && sc[2] < 16 {
+			n = sc[2]
+		}
+		switch sc[0] {
+		case 58:
+			// There are no basic color parameters for the underline color
+			converted = sgrColor{58, 5, n}
+		default:
+			base := byte(30)
+			if sc[0] == 48 {
+				base = 40
+			}
+			if n >= 8 {
+				base += 60
+				n -= 8
+			}
+			converted = sgrColor{base + n}
+		}
+	}
+	downsampleCache.mut.Lock()
+	downsampleCache.colors[key] = converted
+	downsampleCache.mut.Unlock()
+	return converted
+}
+
+// downsample converts the colors of the state to the given color level
+func (s sgrState) downsample(level ColorLevel) sgrState {
+	s.fg = s.fg.downsample(level)
+	s.bg = s.bg.downsample(level)
+	s.ul = s.ul.downsample(level)
+	return s
+}
+
+// Downsample returns the attributes and colors, with the colors converted to the
+// closest ones that can be shown at the given color level. 24-bit colors are converted
+// to the xterm 256 color palette or to the 16 basic colors by finding the color that
+// looks the most similar. For ColorLevelNone, only the attributes are kept.
+func (ac AttributeColor) Downsample(level ColorLevel) AttributeColor {
+	if level >= ColorLevelTrue {
+		return ac
+	}
+	result := make(AttributeColor, 0, len(ac))
+	for _, group := range ac.groups() {
+		b := group[0]
+		switch {
+		case (b == 38 || b == 48 || b == 58) && len(group) > 1:
+			var sc sgrColor
+			copy(sc[:], group)
+			if sc = sc.downsample(level); sc != (sgrColor{}) {
+				result = append(result, sc.params(0)...)
+			}
+		case (30 <= b && b <= 39) || (40 <= b && b <= 49) || (90 <= b && b <= 97) || (100 <= b && b <= 107) || b == 59:
+			if level != ColorLevelNone {
+				result = append(result, b)
+			}
+		default:
+			result = append(result, group...)
+		}
+	}
+	return result
+}
+
+// QueryTrueColor asks the terminal emulator if it supports 24-bit colors, by setting a
+// 24-bit foreground color and then reading it back with a DECRQSS request.
+// Terminals that do not support 24-bit colors, or DECRQSS, report something else or nothing.
+// The TTY should be in raw mode, with a timeout.
+func QueryTrueColor(tty *TTY) (bool, error) {
+	if err := tty.WriteString("\033[38;2;1;2;3m\033P$qm\033\\\033[0m"); err != nil {
+		return false, err
+	}
+	result, err := tty.ReadString()
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(result, "1:2:3") || strings.Contains(result, "1;2;3"), nil
+}
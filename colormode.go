@@ -0,0 +1,116 @@
+package vt100
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ColorMode decides if colors and attributes are written by helpers like
+// AttributeColor.Output, AttributeColor.Get and Words
+type ColorMode int
+
+const (
+	ColorAuto   ColorMode = iota // write colors if the output is a terminal and the environment allows it
+	ColorAlways                  // always write colors
+	ColorNever                   // never write colors, only plain text
+)
+
+// colorModes holds the global color mode and the color modes for specific writers
+var colorModes = struct {
+	mut     *sync.RWMutex
+	global  ColorMode
+	writers map[io.Writer]ColorMode
+}{&sync.RWMutex{}, ColorAuto, make(map[io.Writer]ColorMode)}
+
+// SetColorMode sets the color mode for all output. ColorAuto is the default.
+func SetColorMode(mode ColorMode) {
+	colorModes.mut.Lock()
+	colorModes.global = mode
+	colorModes.mut.Unlock()
+	// Forcing colors can raise the color level of stdout and stderr
+	stdoutTerminal.resetCaps()
+	stderrTerminal.resetCaps()
+}
+
+// SetWriterColorMode sets the color mode for the given writer, like os.Stderr.
+// It has precedence over the global color mode. ColorAuto removes the override.
+// The writer must be comparable, like a pointer.
+func SetWriterColorMode(w io.Writer, mode ColorMode) {
+	if w == nil || !reflect.TypeOf(w).Comparable() {
+		return
+	}
+	colorModes.mut.Lock()
+	if mode == ColorAuto {
+		delete(colorModes.writers, w)
+	} else {
+		colorModes.writers[w] = mode
+	}
+	colorModes.mut.Unlock()
+	stdoutTerminal.resetCaps()
+	stderrTerminal.resetCaps()
+}
+
+// colorMode returns the color mode for the given writer, or the global color mode
+func colorMode(w io.Writer) ColorMode {
+	colorModes.mut.RLock()
+	defer colorModes.mut.RUnlock()
+	if w != nil && reflect.TypeOf(w).Comparable() {
+		if mode, ok := colorModes.writers[w]; ok {
+			return mode
+		}
+	}
+	return colorModes.global
+}
+
+// forcedByEnv returns true, true if FORCE_COLOR or CLICOLOR_FORCE enable colors, and
+// false, true if FORCE_COLOR disables them. Variables that are empty are ignored.
+func forcedByEnv() (forced, set bool) {
+	if force := os.Getenv("FORCE_COLOR"); force != "" {
+		switch strings.ToLower(force) {
+		case "0", "false", "no", "off":
+			return false, true
+		}
+		return true, true
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true, true
+	}
+	return false, false
+}
+
+// colorForced returns true if colors are written to the given writer no matter what the
+// terminal is, because of ColorAlways, FORCE_COLOR or CLICOLOR_FORCE
+func colorForced(w io.Writer) bool {
+	switch colorMode(w) {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	forced, _ := forcedByEnv()
+	return forced
+}
+
+// ColorEnabled returns true if colors should be written to the given writer.
+// The color mode for the writer is used first, then the global color mode.
+// For ColorAuto, FORCE_COLOR or CLICOLOR_FORCE enable colors, while NO_COLOR or
+// CLICOLOR=0 disable them. Otherwise, colors are enabled if the writer is a terminal.
+func ColorEnabled(w io.Writer) bool {
+	switch colorMode(w) {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if forced, set := forcedByEnv(); set {
+		return forced
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("CLICOLOR") == "0" {
+		return false
+	}
+	f, ok := w.(interface{ Fd() uintptr })
+	return ok && isTerminal(f.Fd())
+}
@@ -3,7 +3,9 @@ package vt100
 import (
 	"fmt"
 	"image/color"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -22,6 +24,17 @@ var (
 	Reverse    = NewAttributeColor("Reverse")
 	Hidden     = NewAttributeColor("Hidden")
 
+	// Attributes that are not a part of VT100, but that most terminal emulators support.
+	// They are left out when drawing to a terminal that does not support them, according
+	// to terminfo, and the underline styles then become plain underlines.
+	Italic          = NewAttributeColor("Italic")
+	Strikethrough   = NewAttributeColor("Strikethrough")
+	Overline        = NewAttributeColor("Overline")
+	DoubleUnderline = NewAttributeColor("Double underline")
+	CurlyUnderline  = NewAttributeColor("Curly underline")
+	DottedUnderline = NewAttributeColor("Dotted underline")
+	DashedUnderline = NewAttributeColor("Dashed underline")
+
 	None AttributeColor
 
 	// There is also: reset, dim, underscore, reverse and hidden
@@ -177,6 +190,19 @@ var (
 	smut   = &sync.RWMutex{}
 )
 
+// underlineStyleNames are the names of the underline styles, together with the
+// sub-parameter of 4 that sets them
+var underlineStyleNames = map[string]byte{
+	"Double underline": 2,
+	"double underline": 2,
+	"Curly underline":  3,
+	"curly underline":  3,
+	"Dotted underline": 4,
+	"dotted underline": 4,
+	"Dashed underline": 5,
+	"dashed underline": 5,
+}
+
 func s2b(s string) byte {
 	switch s {
 	case "Reset":
@@ -211,6 +237,18 @@ func s2b(s string) byte {
 		return 8
 	case "hidden":
 		return 8
+	case "Italic":
+		return 3
+	case "italic":
+		return 3
+	case "Strikethrough":
+		return 9
+	case "strikethrough":
+		return 9
+	case "Overline":
+		return 53
+	case "overline":
+		return 53
 	case "Black":
 		return 30
 	case "black":
@@ -1280,9 +1318,13 @@ func b2s(b byte) string {
 }
 
 func NewAttributeColor(attributes ...string) AttributeColor {
-	result := make([]byte, len(attributes))
-	for i, s := range attributes {
-		result[i] = s2b(s) // if the element is not found in the map, 0 is used
+	result := make([]byte, 0, len(attributes))
+	for _, s := range attributes {
+		if style, ok := underlineStyleNames[s]; ok {
+			result = append(result, styledUnderline(style)...)
+			continue
+		}
+		result = append(result, s2b(s)) // if the element is not found in the map, 0 is used
 	}
 	return AttributeColor(result)
 }
@@ -1297,32 +1339,123 @@ func (ac AttributeColor) Tail() []byte {
 	return ac[1:]
 }
 
-// Modify color attributes so that they become background color attributes instead
+// RGB returns a 24-bit "true color" foreground color (38;2;r;g;b).
+// Use Background to get the background color.
+func RGB(r, g, b byte) AttributeColor {
+	return AttributeColor{38, 2, r, g, b}
+}
+
+// Color256 returns a foreground color from the xterm 256 color palette (38;5;n).
+// Use Background to get the background color.
+func Color256(n byte) AttributeColor {
+	return AttributeColor{38, 5, n}
+}
+
+// FromColor returns a 24-bit "true color" foreground color for the given color.
+// The alpha channel is ignored. Use Background to get the background color.
+func FromColor(c color.Color) AttributeColor {
+	nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return RGB(nc.R, nc.G, nc.B)
+}
+
+// groups splits the attributes into SGR parameters, where an extended color,
+// like 38;5;n or 38;2;r;g;b, is one parameter
+func (ac AttributeColor) groups() []AttributeColor {
+	var groups []AttributeColor
+	for i := 0; i < len(ac); {
+		n := paramLen(ac, i)
+		groups = append(groups, ac[i:i+n])
+		i += n
+	}
+	return groups
+}
+
+// Modify color attributes so that they become background color attributes instead.
+// Extended colors, like 38;5;n and 38;2;r;g;b, become 48;5;n and 48;2;r;g;b.
 func (ac AttributeColor) Background() AttributeColor {
 	newA := make(AttributeColor, 0, len(ac))
 	foundOne := false
-	for _, attr := range ac {
-		if (30 <= attr) && (attr <= 39) {
+	groups := ac.groups()
+	for _, group := range groups {
+		switch attr := group[0]; {
+		case (30 <= attr && attr <= 37) || attr == 39 || (90 <= attr && attr <= 97):
 			// convert foreground color to background color attribute
 			newA = append(newA, attr+10)
 			foundOne = true
+		case attr == 38 && len(group) > 1:
+			newA = append(append(newA, 48), group[1:]...)
+			foundOne = true
 		}
 		// skip the rest
 	}
 	// Did not find a background attribute to convert, keep any existing background attributes
 	if !foundOne {
-		for _, attr := range ac {
-			if (40 <= attr) && (attr <= 49) {
-				newA = append(newA, attr)
+		for _, group := range groups {
+			if attr := group[0]; (40 <= attr && attr <= 49 && attr != 48) || (100 <= attr && attr <= 107) || (attr == 48 && len(group) > 1) {
+				newA = append(newA, group...)
 			}
 		}
 	}
 	return newA
 }
 
-// Return the VT100 terminal codes for setting this combination of attributes and color attributes
+// UnderlineColor returns the foreground color as an underline color (58), like
+// Underscore.Combine(Red.UnderlineColor()) for a red underline. The basic colors
+// become colors from the xterm 256 color palette, and the other attributes are skipped.
+func (ac AttributeColor) UnderlineColor() AttributeColor {
+	var newA AttributeColor
+	for _, group := range ac.groups() {
+		switch attr := group[0]; {
+		case 30 <= attr && attr <= 37:
+			newA = append(newA, 58, 5, attr-30)
+		case 90 <= attr && attr <= 97:
+			newA = append(newA, 58, 5, attr-90+8)
+		case attr == 39:
+			newA = append(newA, 59)
+		case attr == 38 && len(group) > 1:
+			newA = append(append(newA, 58), group[1:]...)
+		}
+	}
+	return newA
+}
+
+// degrade returns the attributes and colors that can be shown by a terminal with the
+// given capabilities. The colors are downsampled, the attributes that can not be shown
+// are left out and the underline styles become plain underlines if they are not supported.
+func (ac AttributeColor) degrade(caps sgrCaps) AttributeColor {
+	converted := ac.Downsample(caps.level)
+	if caps.attrs == allCaps.attrs && caps.underlineStyles && caps.underlineColor {
+		return converted
+	}
+	result := make(AttributeColor, 0, len(converted))
+	for _, group := range converted.groups() {
+		switch b := group[0]; {
+		case b == 58 || b == 59:
+			if !caps.underlineColor {
+				continue
+			}
+		case underlineStyle(group, 0) != 0 && !caps.underlineStyles:
+			result = append(result, 4)
+			continue
+		case len(group) == 1 && !caps.supports(b):
+			continue
+		}
+		result = append(result, group...)
+	}
+	return result
+}
+
+// Return the VT100 terminal codes for setting this combination of attributes and color attributes.
+// The colors are converted to the color level of the terminal (see DetectColorLevel), and the
+// attributes that the terminal does not support, according to terminfo, are left out.
 func (ac AttributeColor) String() string {
-	id := string(ac)
+	return ac.sequence(stdoutTerminal.sgrCaps())
+}
+
+// sequence returns the terminal codes for setting the attributes and colors, for a
+// terminal with the given capabilities
+func (ac AttributeColor) sequence(caps sgrCaps) string {
+	id := string(ac) + caps.key()
 
 	smut.RLock()
 	if s, has := scache[id]; has {
@@ -1331,17 +1464,32 @@ func (ac AttributeColor) String() string {
 	}
 	smut.RUnlock()
 
+	converted := ac.degrade(caps)
+	if len(converted) == 0 && len(ac) > 0 {
+		// There is nothing left to set for this terminal
+		return ""
+	}
 	var sb strings.Builder
-	for i, b := range ac {
+	for i, group := range converted.groups() {
 		if i != 0 {
 			sb.WriteRune(';')
 		}
-		sb.WriteString(b2s(b))
+		if style := underlineStyle(group, 0); style != 0 {
+			sb.WriteString("4:")
+			sb.WriteString(strconv.Itoa(int(style)))
+			continue
+		}
+		for j, b := range group {
+			if j != 0 {
+				sb.WriteRune(';')
+			}
+			sb.WriteString(b2s(b))
+		}
 	}
 	attributeString := sb.String()
 
-	// Replace '{attr1};...;{attrn}' with the generated attribute string and return
-	s := get(specVT100, "Set Attribute Mode", map[string]string{"{attr1};...;{attrn}": attributeString})
+	// Replace '{ATTRIBUTES}' with the generated attribute string and return
+	s := get("Set Attribute Mode", map[string]string{"{ATTRIBUTES}": attributeString})
 
 	// Store the value in the cache
 	if len(s) > 0 {
@@ -1353,30 +1501,57 @@ func (ac AttributeColor) String() string {
 	return s
 }
 
-// Get the full string needed for outputting colored texti, with the text and stopping the color attribute
+// wrap returns the text with the terminal codes for setting the attributes before it,
+// if start is true, and for resetting the attributes after it, if stop is true.
+// If colors should not be written to w (see ColorEnabled), only the text is returned.
+// The colors and attributes are converted to what the terminal that writes to w can show.
+func (ac AttributeColor) wrap(w io.Writer, text string, start, stop bool) string {
+	if !ColorEnabled(w) {
+		return text
+	}
+	if start {
+		seq := ac.sequence(terminalFor(w).sgrCaps())
+		if seq == "" {
+			// Nothing is set for this terminal, so there is nothing to reset
+			stop = false
+		}
+		text = seq + text
+	}
+	if stop {
+		text += NoColor()
+	}
+	return text
+}
+
+// Get the full string needed for outputting colored texti, with the text and stopping the color attribute.
+// Only the text is returned if colors should not be written to stdout (see ColorEnabled).
 func (ac AttributeColor) StartStop(text string) string {
-	return ac.String() + text + NoColor()
+	return ac.wrap(os.Stdout, text, true, true)
 }
 
 // An alias for StartStop
 func (ac AttributeColor) Get(text string) string {
-	return ac.String() + text + NoColor()
+	return ac.wrap(os.Stdout, text, true, true)
 }
 
 // Get the full string needed for outputting colored text, with the text, but don't reset the attributes at the end of the string
 func (ac AttributeColor) Start(text string) string {
-	return ac.String() + text
+	return ac.wrap(os.Stdout, text, true, false)
 }
 
 // Get the text and the terminal codes for resetting the attributes
 func (ac AttributeColor) Stop(text string) string {
-	return text + NoColor()
+	return ac.wrap(os.Stdout, text, false, true)
 }
 
 var maybeNoColor *string
 
-// Return a string for resetting the attributes
+// Return a string for resetting the attributes, or an empty string if colors
+// should not be written to stdout (see ColorEnabled)
 func Stop() string {
+	if !ColorEnabled(os.Stdout) {
+		return ""
+	}
 	if maybeNoColor != nil {
 		return *maybeNoColor
 	}
@@ -1386,16 +1561,24 @@ func Stop() string {
 }
 
 // Use this color to output the given text. Will reset the attributes at the end of the string. Outputs a newline.
+// Only the text is written if stdout is not a terminal, or if colors have been disabled (see ColorEnabled).
 func (ac AttributeColor) Output(text string) {
-	fmt.Println(ac.Get(text))
+	ac.Fprintln(os.Stdout, text)
 }
 
 // Same as output, but outputs to stderr instead of stdout
 func (ac AttributeColor) Error(text string) {
-	fmt.Fprintln(os.Stderr, ac.Get(text))
+	ac.Fprintln(os.Stderr, text)
+}
+
+// Fprintln writes the text with this color to the given writer, followed by a newline.
+// Only the text is written if colors should not be written to w (see ColorEnabled).
+func (ac AttributeColor) Fprintln(w io.Writer, text string) {
+	fmt.Fprintln(w, ac.wrap(w, text, true, true))
 }
 
-// Combine the unique bytes from ac and other
+// Combine the unique attributes and colors from ac and other.
+// Extended colors, like 38;2;r;g;b, are compared as a whole.
 func (ac AttributeColor) Combine(other AttributeColor) AttributeColor {
 	lac := len(ac)
 	if lac == 0 {
@@ -1407,23 +1590,19 @@ func (ac AttributeColor) Combine(other AttributeColor) AttributeColor {
 	} else if lot == 1 && lac == 1 {
 		return AttributeColor([]byte{ac[0], other[0]})
 	}
-	counter := 0
-	combined := make(AttributeColor, lac+lot)
-	for i := 0; i < lac; i++ {
-		combined[counter] = ac[i]
-		counter++
-	}
+	combined := make(AttributeColor, lac, lac+lot)
+	copy(combined, ac)
+	groups := ac.groups()
 OUT:
-	for i := 0; i < lot; i++ {
-		for i2 := 0; i2 < lac; i2++ {
-			if ac[i2] == other[i] {
+	for _, group := range other.groups() {
+		for _, existing := range groups {
+			if string(existing) == string(group) {
 				continue OUT
 			}
 		}
-		combined[counter] = other[i]
-		counter++
+		combined = append(combined, group...)
 	}
-	return AttributeColor(combined[:counter])
+	return combined
 }
 
 // Return a new AttributeColor that has "Bright" added to the list of attributes
@@ -1443,20 +1622,25 @@ func WriteRune(x, y int, r rune, fg, bg AttributeColor) {
 	fmt.Print(fg.Combine(bg).Get(string(r)))
 }
 
+// Ints returns the SGR parameters as numbers. For the underline styles, like 4:3,
+// both the parameter and the sub-parameter are included.
 func (ac AttributeColor) Ints() []int {
-	il := make([]int, len(ac))
-	for index, b := range ac {
-		il[index] = int(b)
+	il := make([]int, 0, len(ac))
+	for _, b := range ac {
+		if b == subParam {
+			continue
+		}
+		il = append(il, int(b))
 	}
 	return il
 }
 
-// This is not part of the VT100 spec, but an easteregg for displaying 24-bit
-// "true color" on some terminals. Example use:
+// This is not part of the VT100 spec, but for displaying 24-bit
+// "true color" on terminals that support it. Example use:
 // fmt.Println(vt100.TrueColor(color.RGBA{0xa0, 0xe0, 0xff, 0xff}, "TrueColor"))
+// The color is converted to the color level of the terminal (see DetectColorLevel).
 func TrueColor(fg color.Color, text string) string {
-	c := color.NRGBAModel.Convert(fg).(color.NRGBA)
-	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm%s\x1b[0m", c.R, c.G, c.B, text)
+	return FromColor(fg).Get(text)
 }
 
 // Equal checks if two colors have the same attributes, in the same order.
@@ -1,7 +1,12 @@
 package vt100
 
 import (
+	"bytes"
 	"fmt"
+	"image/color"
+	"os"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -110,3 +115,267 @@ func BenchmarkB2s(b *testing.B) {
 		b2s(34) // 34 corresponds to "Blue" in s2b function
 	}
 }
+
+func TestDownsample(t *testing.T) {
+	red := AttributeColor{38, 2, 255, 0, 0}
+	for _, tc := range []struct {
+		ac    AttributeColor
+		level ColorLevel
+		want  AttributeColor
+	}{
+		{red, ColorLevelTrue, red},
+		{red, ColorLevel256, AttributeColor{38, 5, 196}},
+		{red, ColorLevel16, AttributeColor{91}},
+		{AttributeColor{1, 48, 2, 0, 0, 0xee}, ColorLevel16, AttributeColor{1, 44}},
+		{AttributeColor{48, 5, 3}, ColorLevel16, AttributeColor{43}},
+		{AttributeColor{38, 5, 250}, ColorLevel256, AttributeColor{38, 5, 250}},
+		{AttributeColor{38, 2, 0x30, 0x30, 0x31}, ColorLevel256, AttributeColor{38, 5, 236}},
+		{AttributeColor{1, 31, 44, 38, 5, 100}, ColorLevelNone, AttributeColor{1}},
+	} {
+		if got := tc.ac.Downsample(tc.level); !got.Equal(tc.want) {
+			t.Errorf("%v at %v: got %v, want %v", tc.ac, tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestDetectColorLevel(t *testing.T) {
+	for _, tc := range []struct {
+		colorterm, term string
+		want            ColorLevel
+	}{
+		{"truecolor", "xterm", ColorLevelTrue},
+		{"", "xterm-256color", ColorLevel256},
+		{"", "xterm-direct", ColorLevelTrue},
+		{"", "vt100", ColorLevel16},
+		{"", "dumb", ColorLevelNone},
+		{"", "", ColorLevelNone},
+	} {
+		if got := detectColorLevel(tc.colorterm, tc.term, nil); got != tc.want {
+			t.Errorf("COLORTERM=%q TERM=%q: got %v, want %v", tc.colorterm, tc.term, got, tc.want)
+		}
+	}
+	ti := &Terminfo{Names: []string{"test"}, Bools: map[string]bool{}, Numbers: map[string]int{"colors": 256}}
+	if got := detectColorLevel("", "test", ti); got != ColorLevel256 {
+		t.Errorf("expected 256 colors from terminfo, got %v", got)
+	}
+	ti.Bools["RGB"] = true
+	if got := detectColorLevel("", "test", ti); got != ColorLevelTrue {
+		t.Errorf("expected true color from terminfo, got %v", got)
+	}
+}
+
+func TestTerminalColorLevel(t *testing.T) {
+	var buf bytes.Buffer
+	term := NewTerminal(&buf)
+	SetWriterColorMode(term, ColorAlways)
+	defer SetWriterColorMode(term, ColorAuto)
+
+	// The colors are converted to the color level of the terminal that is written to
+	red := RGB(255, 0, 0)
+	term.SetColorLevel(ColorLevel256)
+	red.Fprintln(term, "x")
+	term.SetColorLevel(ColorLevelNone)
+	red.Fprintln(term, "x")
+	term.SetColorLevel(ColorLevel16)
+	red.Fprintln(term, "x")
+	if got, want := buf.String(), "\033[38;05;196mx\033[0m\nx\n\033[91mx\033[0m\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExtendedColors(t *testing.T) {
+	for _, tc := range []struct {
+		got, want AttributeColor
+	}{
+		{RGB(1, 2, 3).Background(), AttributeColor{48, 2, 1, 2, 3}},
+		{Color256(200).Background(), AttributeColor{48, 5, 200}},
+		{LightRed.Background(), AttributeColor{101}},
+		{Bright.Combine(RGB(1, 2, 3)).Background(), AttributeColor{48, 2, 1, 2, 3}},
+		{BackgroundBlue.Combine(Color256(3).Background()).Background(), AttributeColor{44, 48, 5, 3}},
+		{RGB(5, 5, 5).Combine(RGB(5, 5, 6)), AttributeColor{38, 2, 5, 5, 5, 38, 2, 5, 5, 6}},
+		{RGB(5, 5, 5).Combine(RGB(5, 5, 5).Background()), AttributeColor{38, 2, 5, 5, 5, 48, 2, 5, 5, 5}},
+		{Bright.Combine(Color256(1)).Combine(Color256(1)), AttributeColor{1, 38, 5, 1}},
+		{FromColor(color.NRGBA{10, 20, 30, 128}), RGB(10, 20, 30)},
+	} {
+		if !tc.got.Equal(tc.want) {
+			t.Errorf("got %v, want %v", tc.got, tc.want)
+		}
+	}
+	if got, want := ansiCodeToColor(Color256(196), true), (color.NRGBA{255, 0, 0, 255}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := ansiCodeToColor(Bright.Combine(RGB(1, 2, 3).Background()), false), (color.NRGBA{1, 2, 3, 255}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestColorMode(t *testing.T) {
+	t.Setenv("FORCE_COLOR", "1")
+	t.Setenv("CLICOLOR_FORCE", "")
+	t.Setenv("NO_COLOR", "")
+	defer SetColorMode(ColorAuto)
+	SetColorMode(ColorNever)
+	if got := Red.Get("x") + Words("a b", "red") + Stop(); got != "xa b" {
+		t.Errorf("expected plain text, got %q", got)
+	}
+	SetColorMode(ColorAlways)
+	if got := Red.Get("x"); got != Red.String()+"x"+NoColor() {
+		t.Errorf("expected colored text, got %q", got)
+	}
+	// The mode for a writer has precedence over the global mode
+	var buf bytes.Buffer
+	SetWriterColorMode(&buf, ColorNever)
+	Red.Fprintln(&buf, "x")
+	SetWriterColorMode(&buf, ColorAuto)
+	if got := buf.String(); got != "x\n" {
+		t.Errorf("expected plain text, got %q", got)
+	}
+	SetColorMode(ColorAuto)
+	if !ColorEnabled(&buf) {
+		t.Error("expected FORCE_COLOR to enable colors")
+	}
+	t.Setenv("FORCE_COLOR", "0")
+	if ColorEnabled(&buf) {
+		t.Error("expected FORCE_COLOR=0 to disable colors")
+	}
+	t.Setenv("FORCE_COLOR", "")
+	t.Setenv("CLICOLOR_FORCE", "1")
+	if !ColorEnabled(&buf) {
+		t.Error("expected CLICOLOR_FORCE to enable colors")
+	}
+	t.Setenv("CLICOLOR_FORCE", "")
+	if ColorEnabled(&buf) {
+		t.Error("expected no colors for a writer that is not a terminal")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if ColorEnabled(os.Stdout) {
+		t.Error("expected NO_COLOR to disable colors")
+	}
+}
+
+func TestForcedColorWithoutTerm(t *testing.T) {
+	t.Setenv("TERM", "")
+	t.Setenv("COLORTERM", "")
+	t.Setenv("CLICOLOR_FORCE", "")
+	t.Setenv("NO_COLOR", "")
+	ti := stdoutTerminal.Terminfo()
+	stdoutTerminal.SetTerminfo(nil)
+	stdoutTerminal.mut.Lock()
+	level, levelSet := stdoutTerminal.level, stdoutTerminal.levelSet
+	stdoutTerminal.levelSet = false
+	stdoutTerminal.caps = nil
+	stdoutTerminal.mut.Unlock()
+	defer func() {
+		stdoutTerminal.SetTerminfo(ti)
+		stdoutTerminal.mut.Lock()
+		stdoutTerminal.level, stdoutTerminal.levelSet = level, levelSet
+		stdoutTerminal.caps = nil
+		stdoutTerminal.mut.Unlock()
+		SetColorMode(ColorAuto)
+	}()
+
+	// Forcing colors gives at least 16 colors, even if $TERM says that there are none
+	for _, force := range []func(){
+		func() { t.Setenv("FORCE_COLOR", ""); SetColorMode(ColorAlways) },
+		func() { t.Setenv("FORCE_COLOR", "1"); SetColorMode(ColorAuto) },
+	} {
+		force()
+		if level := DetectColorLevel(); level != ColorLevel16 {
+			t.Errorf("expected 16 colors, got %s", level)
+		}
+		if got, want := Red.Get("x"), "\033[31mx\033[0m"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	// If no colors are set, there is nothing to reset either
+	SetColorLevel(ColorLevelNone)
+	if got := Red.Get("x"); got != "x" {
+		t.Errorf("expected plain text, got %q", got)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want AttributeColor
+	}{
+		{"red", Red},
+		{"Bold LightBlue on blue", AttributeColor{1, 94, 44}},
+		{"#f80", RGB(0xff, 0x88, 0x00)},
+		{"#FF8800", RGB(0xff, 0x88, 0x00)},
+		{"underline rgb(255, 136, 0)", AttributeColor{4, 38, 2, 255, 136, 0}},
+		{"rgb(100% 0% 50%)", RGB(255, 0, 128)},
+		{"hsl(120, 100%, 25%)", RGB(0, 128, 0)},
+		{"hsl(-90deg 100% 50%)", RGB(128, 0, 255)},
+		{"cornflowerblue", RGB(100, 149, 237)},
+		{"ansi:12", LightBlue},
+		{"ansi:3 on ansi:9", AttributeColor{33, 101}},
+		{"on 256:17", AttributeColor{48, 5, 17}},
+		{"256:208 on rgb(1,2,3)", AttributeColor{38, 5, 208, 48, 2, 1, 2, 3}},
+		{"reverse", Reverse},
+		{"default on default", AttributeColor{39, 49}},
+	} {
+		got, err := ParseColor(tc.s)
+		if err != nil {
+			t.Errorf("%q: %v", tc.s, err)
+			continue
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("%q: got %d, want %d", tc.s, []byte(got), []byte(tc.want))
+		}
+	}
+	for _, s := range []string{"", "nocolor", "#12345", "#ggg", "rgb(1, 2)", "rgb(1, 2, 300)", "hsl(1, 2, 3)x", "ansi:16", "256:256", "red blue", "on", "red on blue on green", "on red green"} {
+		if _, err := ParseColor(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestTextAttributes(t *testing.T) {
+	if got, want := []byte(Italic.Combine(CurlyUnderline).Combine(Red.UnderlineColor())), []byte{3, 4, subParam, 3, 58, 5, 1}; !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := []byte(AttributeColor{1, 38, 2, 1, 2, 3, 44}.UnderlineColor()), []byte{58, 2, 1, 2, 3}; !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var s sgrState
+	s.apply(AttributeColor{3, 9, 53, 4, subParam, 4, 58, 5, 200})
+	if s.attrs != attrItalic|attrStrike|attrOverline|attrUnderscore || s.ulStyle != 4 || s.ul != (sgrColor{58, 5, 200}) {
+		t.Errorf("unexpected state: %+v", s)
+	}
+	s.apply(AttributeColor{23, 29, 55, 59, 4})
+	if s.attrs != attrUnderscore || s.ulStyle != 0 || s.ul != (sgrColor{}) {
+		t.Errorf("unexpected state: %+v", s)
+	}
+	var sb strings.Builder
+	writeSGR(&sb, AttributeColor{3, 4, subParam, 2, 38, 2, 242, 243, 244})
+	if got, want := sb.String(), "\033[3;4:2;38;2;242;243;244m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	styled := AttributeColor{1, 3, 9, 53, 4, subParam, 3, 58, 2, 255, 0, 0}
+	for _, tc := range []struct {
+		caps sgrCaps
+		want AttributeColor
+	}{
+		{allCaps, styled},
+		{sgrCaps{level: ColorLevelTrue, attrs: attrBright | attrUnderscore}, AttributeColor{1, 4}},
+		{sgrCaps{level: ColorLevel16, attrs: ^uint16(0), underlineStyles: true, underlineColor: true}, AttributeColor{1, 3, 9, 53, 4, subParam, 3, 58, 5, 9}},
+	} {
+		if got := styled.degrade(tc.caps); !got.Equal(tc.want) {
+			t.Errorf("%+v: got %d, want %d", tc.caps, []byte(got), []byte(tc.want))
+		}
+	}
+	if got, err := ParseColor("italic curly-underline red on blue"); err != nil || !got.Equal(AttributeColor{3, 4, subParam, 3, 31, 44}) {
+		t.Errorf("got %d, %v", []byte(got), err)
+	}
+	if got, want := Italic.Combine(CurlyUnderline).sequence(allCaps), "\033[03;4:3m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := (AttributeColor{243}).sequence(allCaps), "\033[243m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := CurlyUnderline.Ints(), []int{4, 3}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,465 @@
+package vt100
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Command is a terminal command, like "Cursor Up", together with the names of its
+// parameters and a description. Use Sequence to get the escape sequence.
+type Command struct {
+	Name        string
+	Params      []string // names of the parameters, like "ROW" and "COLUMN"
+	Description string
+	format      string // the escape sequence, with a {NAME} placeholder per parameter
+	bare        string // the escape sequence with all parameters left out
+}
+
+// commandTable is the definition of all terminal commands. The sequences have been
+// checked against the VT100 and xterm documentation.
+var commandTable = []Command{
+	{Name: "Query Device Code", format: "\033[c",
+		Description: "Requests a Report Device Code response from the device."},
+	{Name: "Report Device Code", Params: []string{"CODE"}, format: "\033[?{CODE}c",
+		Description: "Generated by the device in response to a Query Device Code request."},
+	{Name: "Query Device Status", format: "\033[5n",
+		Description: "Requests a Report Device Status response from the device."},
+	{Name: "Report Device OK", format: "\033[0n",
+		Description: "Generated by the device in response to a Query Device Status request; indicates that the device is functioning correctly."},
+	{Name: "Report Device Failure", format: "\033[3n",
+		Description: "Generated by the device in response to a Query Device Status request; indicates that the device is functioning improperly."},
+	{Name: "Query Cursor Position", format: "\033[6n",
+		Description: "Requests a Report Cursor Position response from the device."},
+	{Name: "Report Cursor Position", Params: []string{"ROW", "COLUMN"}, format: "\033[{ROW};{COLUMN}R",
+		Description: "Generated by the device in response to a Query Cursor Position request; reports the current cursor position."},
+	{Name: "Reset Device", format: "\033c",
+		Description: "Reset all terminal settings to default."},
+	{Name: "Enable Line Wrap", format: "\033[?7h",
+		Description: "Text wraps to the next line if it is longer than the length of the display area."},
+	{Name: "Disable Line Wrap", format: "\033[?7l",
+		Description: "Disables line wrapping."},
+	{Name: "Show Cursor", format: showCursorCode,
+		Description: "Makes the cursor visible."},
+	{Name: "Hide Cursor", format: hideCursorCode,
+		Description: "Makes the cursor invisible."},
+	{Name: "Disable Local Echo", format: "\033[12h",
+		Description: "Characters that are typed are not shown by the terminal itself."},
+	{Name: "Enter Alternate Screen", format: enterAltScreenCode,
+		Description: "Switches to the alternate screen buffer, which has no scrollback."},
+	{Name: "Leave Alternate Screen", format: leaveAltScreenCode,
+		Description: "Switches back to the normal screen buffer."},
+	{Name: "Enable Mouse Tracking", format: "\033[?1002h\033[?1006h",
+		Description: "Reports mouse button presses, releases, wheel movements and movements with a button held down, with SGR encoded coordinates."},
+	{Name: "Disable Mouse Tracking", format: "\033[?1006l\033[?1002l",
+		Description: "Stops reporting mouse events."},
+	{Name: "Enable Bracketed Paste", format: "\033[?2004h",
+		Description: "Pasted text is surrounded by ESC[200~ and ESC[201~, so that it can be told apart from typed text."},
+	{Name: "Disable Bracketed Paste", format: "\033[?2004l",
+		Description: "Pasted text is sent as if it was typed."},
+	{Name: "Font Set G0", format: "\x0f",
+		Description: "Set the default font (Shift In)."},
+	{Name: "Font Set G1", format: "\x0e",
+		Description: "Set the alternate font (Shift Out)."},
+	{Name: "Cursor Home", Params: []string{"ROW", "COLUMN"}, format: "\033[{ROW};{COLUMN}H",
+		Description: "Sets the cursor position where subsequent text will begin. If no row/column parameters are provided, the cursor will move to the home position, at the upper left of the screen."},
+	{Name: "Cursor Up", Params: []string{"COUNT"}, format: "\033[{COUNT}A",
+		Description: "Moves the cursor up by COUNT rows; the default count is 1."},
+	{Name: "Cursor Down", Params: []string{"COUNT"}, format: "\033[{COUNT}B",
+		Description: "Moves the cursor down by COUNT rows; the default count is 1."},
+	{Name: "Cursor Forward", Params: []string{"COUNT"}, format: "\033[{COUNT}C",
+		Description: "Moves the cursor forward by COUNT columns; the default count is 1."},
+	{Name: "Cursor Backward", Params: []string{"COUNT"}, format: "\033[{COUNT}D",
+		Description: "Moves the cursor backward by COUNT columns; the default count is 1."},
+	{Name: "Cursor Next Line", Params: []string{"COUNT"}, format: "\033[{COUNT}E",
+		Description: "Moves the cursor to the start of the line COUNT rows down; the default count is 1."},
+	{Name: "Cursor Previous Line", Params: []string{"COUNT"}, format: "\033[{COUNT}F",
+		Description: "Moves the cursor to the start of the line COUNT rows up; the default count is 1."},
+	{Name: "Cursor Horizontal Absolute", Params: []string{"COLUMN"}, format: "\033[{COLUMN}G",
+		Description: "Moves the cursor to the given column of the current row; the default column is 1."},
+	{Name: "Line Position Absolute", Params: []string{"ROW"}, format: "\033[{ROW}d",
+		Description: "Moves the cursor to the given row, without changing the column; the default row is 1."},
+	{Name: "Force Cursor Position", Params: []string{"ROW", "COLUMN"}, format: "\033[{ROW};{COLUMN}f",
+		Description: "Identical to Cursor Home."},
+	{Name: "Save Cursor", format: "\033[s",
+		Description: "Save the current cursor position."},
+	{Name: "Unsave Cursor", format: "\033[u",
+		Description: "Restores the cursor position after a Save Cursor."},
+	{Name: "Save Cursor & Attrs", format: saveCursorCode,
+		Description: "Save the current cursor position and display attributes."},
+	{Name: "Restore Cursor & Attrs", format: restoreCursorCode,
+		Description: "Restores the cursor position and display attributes after a Save Cursor & Attrs."},
+	{Name: "Scroll Screen", format: "\033[r",
+		Description: "Enable scrolling for the entire display."},
+	{Name: "Scroll Region", Params: []string{"START", "END"}, format: "\033[{START};{END}r",
+		Description: "Enable scrolling from row START to row END."},
+	{Name: "Index", format: "\033D",
+		Description: "Moves the cursor down one line, and scrolls the display up if the cursor is at the bottom."},
+	{Name: "Reverse Index", format: "\033M",
+		Description: "Moves the cursor up one line, and scrolls the display down if the cursor is at the top."},
+	{Name: "Scroll Up", Params: []string{"COUNT"}, format: "\033[{COUNT}S",
+		Description: "Scrolls the display up by COUNT lines, adding blank lines at the bottom; the default count is 1."},
+	{Name: "Scroll Down", Params: []string{"COUNT"}, format: "\033[{COUNT}T",
+		Description: "Scrolls the display down by COUNT lines, adding blank lines at the top; the default count is 1."},
+	{Name: "Set Tab", format: "\033H",
+		Description: "Sets a tab at the current position."},
+	{Name: "Clear Tab", format: "\033[g",
+		Description: "Clears the tab at the current position."},
+	{Name: "Clear All Tabs", format: "\033[3g",
+		Description: "Clears all tabs."},
+	{Name: "Erase End of Line", format: "\033[K",
+		Description: "Erases from the current cursor position to the end of the current line."},
+	{Name: "Erase Start of Line", format: "\033[1K",
+		Description: "Erases from the current cursor position to the start of the current line."},
+	{Name: "Erase Line", format: "\033[2K",
+		Description: "Erases the entire current line."},
+	{Name: "Erase Down", format: "\033[J",
+		Description: "Erases the screen from the current line down to the bottom of the screen."},
+	{Name: "Erase Up", format: "\033[1J",
+		Description: "Erases the screen from the current line up to the top of the screen."},
+	{Name: "Erase Screen", format: "\033[2J",
+		Description: "Erases the screen with the background colour. The cursor is not moved."},
+	{Name: "Erase Characters", Params: []string{"COUNT"}, format: "\033[{COUNT}X",
+		Description: "Erases COUNT characters from the cursor position, without moving the rest of the line; the default count is 1."},
+	{Name: "Insert Lines", Params: []string{"COUNT"}, format: "\033[{COUNT}L",
+		Description: "Inserts COUNT blank lines at the current line, moving the lines below it down; the default count is 1."},
+	{Name: "Delete Lines", Params: []string{"COUNT"}, format: "\033[{COUNT}M",
+		Description: "Deletes COUNT lines from the current line, moving the lines below it up; the default count is 1."},
+	{Name: "Insert Characters", Params: []string{"COUNT"}, format: "\033[{COUNT}@",
+		Description: "Inserts COUNT blank characters at the cursor position, moving the rest of the line to the right; the default count is 1."},
+	{Name: "Delete Characters", Params: []string{"COUNT"}, format: "\033[{COUNT}P",
+		Description: "Deletes COUNT characters from the cursor position, moving the rest of the line to the left; the default count is 1."},
+	{Name: "Soft Reset", format: "\033[!p",
+		Description: "Resets the display attributes, modes, scrolling region and saved cursor, without clearing the screen (DECSTR)."},
+	{Name: "Set Key Definition", Params: []string{"KEY", "STRING"}, format: "\033[{KEY};\"{STRING}\"p",
+		Description: "Associates a string of text to a keyboard key. KEY indicates the key by its ASCII value in decimal."},
+	{Name: "Set Attribute Mode", Params: []string{"ATTRIBUTES"}, format: "\033[{ATTRIBUTES}m",
+		Description: "Sets multiple display attribute settings, separated by semicolons."},
+}
+
+// commandIndex is the position of each command in commandTable, by name
+var commandIndex = func() map[string]int {
+	m := make(map[string]int, len(commandTable))
+	for i := range commandTable {
+		cmd := &commandTable[i]
+		cmd.bare = cmd.format
+		if start, end := strings.Index(cmd.format, "{"), strings.LastIndex(cmd.format, "}"); start != -1 && end > start {
+			cmd.bare = cmd.format[:start] + cmd.format[end+1:]
+		}
+		m[cmd.Name] = i
+	}
+	return m
+}()
+
+// Commands returns all available terminal commands. They are copies, so changing
+// them does not change the commands that are used.
+func Commands() []Command {
+	commands := make([]Command, len(commandTable))
+	for i := range commandTable {
+		commands[i] = commandTable[i].clone()
+	}
+	return commands
+}
+
+// LookupCommand returns the terminal command with the given name, like "Cursor Up",
+// or an error if there is no such command
+func LookupCommand(name string) (Command, error) {
+	if i, ok := commandIndex[name]; ok {
+		return commandTable[i].clone(), nil
+	}
+	return Command{}, fmt.Errorf("unknown terminal command: %q", name)
+}
+
+// clone returns a copy of the command that does not share the parameter names
+func (cmd *Command) clone() Command {
+	c := *cmd
+	c.Params = slices.Clone(cmd.Params)
+	return c
+}
+
+// mustCommand returns the terminal command with the given name, and panics if there is none
+func mustCommand(name string) *Command {
+	i, ok := commandIndex[name]
+	if !ok {
+		panic("unknown terminal command: " + name)
+	}
+	return &commandTable[i]
+}
+
+// Sequence returns the escape sequence for the command, with the given parameters.
+// Parameters that are not given are left out, so that the terminal uses its defaults.
+// If more arguments than parameters are given, the extra arguments are added to the
+// last parameter, separated by semicolons, like for "Set Attribute Mode".
+func (cmd *Command) Sequence(args ...uint) string {
+	if len(args) == 0 {
+		return cmd.bare
+	}
+	s := cmd.format
+	for i, name := range cmd.Params {
+		var value string
+		switch {
+		case i >= len(args):
+		case i == len(cmd.Params)-1:
+			var sb strings.Builder
+			for j, arg := range args[i:] {
+				if j > 0 {
+					sb.WriteByte(';')
+				}
+				sb.WriteString(strconv.FormatUint(uint64(arg), 10))
+			}
+			value = sb.String()
+		default:
+			value = strconv.FormatUint(uint64(args[i]), 10)
+		}
+		s = strings.Replace(s, "{"+name+"}", value, 1)
+	}
+	return s
+}
+
+// Typed terminal commands
+var (
+	cmdShowCursor     = mustCommand("Show Cursor")
+	cmdHideCursor     = mustCommand("Hide Cursor")
+	cmdEnterAltScreen = mustCommand("Enter Alternate Screen")
+	cmdLeaveAltScreen = mustCommand("Leave Alternate Screen")
+	cmdEnableMouse    = mustCommand("Enable Mouse Tracking")
+	cmdDisableMouse   = mustCommand("Disable Mouse Tracking")
+	cmdEnablePaste    = mustCommand("Enable Bracketed Paste")
+	cmdDisablePaste   = mustCommand("Disable Bracketed Paste")
+	cmdSaveCursor     = mustCommand("Save Cursor & Attrs")
+	cmdRestoreCursor  = mustCommand("Restore Cursor & Attrs")
+	cmdCursorHome     = mustCommand("Cursor Home")
+	cmdCursorUp       = mustCommand("Cursor Up")
+	cmdCursorDown     = mustCommand("Cursor Down")
+	cmdCursorForward  = mustCommand("Cursor Forward")
+	cmdCursorBackward = mustCommand("Cursor Backward")
+	cmdCursorNextLine = mustCommand("Cursor Next Line")
+	cmdCursorPrevLine = mustCommand("Cursor Previous Line")
+	cmdCursorColumn   = mustCommand("Cursor Horizontal Absolute")
+	cmdCursorRow      = mustCommand("Line Position Absolute")
+	cmdScrollRegion   = mustCommand("Scroll Region")
+	cmdScrollUp       = mustCommand("Scroll Up")
+	cmdScrollDown     = mustCommand("Scroll Down")
+	cmdEraseChars     = mustCommand("Erase Characters")
+	cmdInsertLines    = mustCommand("Insert Lines")
+	cmdDeleteLines    = mustCommand("Delete Lines")
+	cmdInsertChars    = mustCommand("Insert Characters")
+	cmdDeleteChars    = mustCommand("Delete Characters")
+	cmdSoftReset      = mustCommand("Soft Reset")
+	cmdAttributeMode  = mustCommand("Set Attribute Mode")
+)
+
+// CursorPosition returns the terminal command for moving the cursor to x,y (0,0 is top left)
+func CursorPosition(x, y uint) string {
+	return cmdCursorHome.Sequence(y+1, x+1)
+}
+
+// CursorUp returns the terminal command for moving the cursor up n rows
+func CursorUp(n uint) string {
+	return cmdCursorUp.Sequence(n)
+}
+
+// CursorDown returns the terminal command for moving the cursor down n rows
+func CursorDown(n uint) string {
+	return cmdCursorDown.Sequence(n)
+}
+
+// CursorForward returns the terminal command for moving the cursor n columns to the right
+func CursorForward(n uint) string {
+	return cmdCursorForward.Sequence(n)
+}
+
+// CursorBackward returns the terminal command for moving the cursor n columns to the left
+func CursorBackward(n uint) string {
+	return cmdCursorBackward.Sequence(n)
+}
+
+// CNL returns the terminal command for moving the cursor to the start of the line n rows down
+func CNL(n uint) string {
+	return cmdCursorNextLine.Sequence(n)
+}
+
+// CPL returns the terminal command for moving the cursor to the start of the line n rows up
+func CPL(n uint) string {
+	return cmdCursorPrevLine.Sequence(n)
+}
+
+// CHA returns the terminal command for moving the cursor to column x of the current row
+// (0 is the leftmost column)
+func CHA(x uint) string {
+	return cmdCursorColumn.Sequence(x + 1)
+}
+
+// VPA returns the terminal command for moving the cursor to row y, without changing
+// the column (0 is the top row)
+func VPA(y uint) string {
+	return cmdCursorRow.Sequence(y + 1)
+}
+
+// EraseMode is which part of a line or of the screen that should be erased
+type EraseMode uint
+
+const (
+	EraseToEnd   EraseMode = iota // from the cursor to the end
+	EraseToStart                  // from the start up to the cursor
+	EraseAll                      // everything
+)
+
+// The terminal commands for each EraseMode
+var (
+	eraseLineCommands    = [...]*Command{EraseToEnd: mustCommand("Erase End of Line"), EraseToStart: mustCommand("Erase Start of Line"), EraseAll: mustCommand("Erase Line")}
+	eraseDisplayCommands = [...]*Command{EraseToEnd: mustCommand("Erase Down"), EraseToStart: mustCommand("Erase Up"), EraseAll: mustCommand("Erase Screen")}
+)
+
+// EraseLine returns the terminal command for erasing the given part of the current line
+func EraseLine(mode EraseMode) string {
+	if int(mode) >= len(eraseLineCommands) {
+		return ""
+	}
+	return eraseLineCommands[mode].Sequence()
+}
+
+// EraseDisplay returns the terminal command for erasing the given part of the screen
+func EraseDisplay(mode EraseMode) string {
+	if int(mode) >= len(eraseDisplayCommands) {
+		return ""
+	}
+	return eraseDisplayCommands[mode].Sequence()
+}
+
+// ScrollRegion returns the terminal command for only scrolling the rows from top to
+// bottom (0 is the top row). The cursor is moved to the home position.
+func ScrollRegion(top, bottom uint) string {
+	return cmdScrollRegion.Sequence(top+1, bottom+1)
+}
+
+// SU returns the terminal command for scrolling the display (or the scroll region) up n lines
+func SU(n uint) string {
+	return cmdScrollUp.Sequence(n)
+}
+
+// SD returns the terminal command for scrolling the display (or the scroll region) down n lines
+func SD(n uint) string {
+	return cmdScrollDown.Sequence(n)
+}
+
+// ECH returns the terminal command for erasing n characters, starting at the cursor
+func ECH(n uint) string {
+	return cmdEraseChars.Sequence(n)
+}
+
+// IL returns the terminal command for inserting n blank lines at the cursor
+func IL(n uint) string {
+	return cmdInsertLines.Sequence(n)
+}
+
+// DL returns the terminal command for deleting n lines, starting with the line of the cursor
+func DL(n uint) string {
+	return cmdDeleteLines.Sequence(n)
+}
+
+// ICH returns the terminal command for inserting n blank characters at the cursor
+func ICH(n uint) string {
+	return cmdInsertChars.Sequence(n)
+}
+
+// DCH returns the terminal command for deleting n characters, starting at the cursor
+func DCH(n uint) string {
+	return cmdDeleteChars.Sequence(n)
+}
+
+// DECSTR returns the terminal command for a soft reset of the terminal
+func DECSTR() string {
+	return cmdSoftReset.Sequence()
+}
+
+// SGR returns the "Set Attribute Mode" terminal command for the given attributes and colors
+func SGR(params ...uint) string {
+	return cmdAttributeMode.Sequence(params...)
+}
+
+// legacyPlaceholders maps placeholders from the old text specification to the ones used now
+var legacyPlaceholders = map[string]string{
+	"{attr1};...;{attrn}": "{ATTRIBUTES}",
+	"{start}":             "{START}",
+	"{end}":               "{END}",
+	"{key}":               "{KEY}",
+	"{string}":            "{STRING}",
+	"{code}":              "{CODE}",
+}
+
+// get returns the terminal codes for the given command name and a map to replace the
+// placeholders with, like {"{COUNT}": "2"}. Placeholders that are not replaced are left out.
+// Returns "" if there is no command with the given name.
+func get(command string, replacemap map[string]string) string {
+	if command == "" {
+		return ""
+	}
+	// Replace the placeholders in a fixed order, so that the result and the memo key
+	// are the same every time
+	keys := make([]string, 0, len(replacemap))
+	for k := range replacemap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString("get:")
+	sb.WriteString(command)
+	for _, k := range keys {
+		sb.WriteString(k)
+		sb.WriteString(replacemap[k])
+		sb.WriteString(";")
+	}
+	combined := sb.String()
+
+	memoMut.RLock()
+	if val, ok := memo[combined]; ok {
+		memoMut.RUnlock()
+		return val
+	}
+	memoMut.RUnlock()
+
+	i, ok := commandIndex[command]
+	if !ok {
+		return ""
+	}
+	cmd := &commandTable[i]
+	termCommand := cmd.bare
+	if len(replacemap) > 0 {
+		termCommand = cmd.format
+		for _, k := range keys {
+			v := replacemap[k]
+			if newKey, ok := legacyPlaceholders[k]; ok {
+				k = newKey
+			}
+			termCommand = strings.Replace(termCommand, k, v, 1)
+		}
+		for _, name := range cmd.Params {
+			termCommand = strings.Replace(termCommand, "{"+name+"}", "", 1)
+		}
+	}
+
+	memoMut.Lock()
+	memo[combined] = termCommand
+	memoMut.Unlock()
+
+	return termCommand
+}
+
+// send writes the terminal command with the given name and parameters to the given terminal.
+// Either all the parameters or none of them must be given, except for Set Attribute Mode,
+// which takes any number of attributes.
+func send(t *Terminal, name string, args ...uint) error {
+	i, ok := commandIndex[name]
+	if !ok {
+		return fmt.Errorf("unknown terminal command: %q", name)
+	}
+	cmd := &commandTable[i]
+	if n := len(args); n != 0 && n != len(cmd.Params) && cmd != cmdAttributeMode {
+		return fmt.Errorf("terminal command %q takes %d parameters, not %d", name, len(cmd.Params), n)
+	}
+	t.Print(t.sequence(cmd, args...))
+	return nil
+}
@@ -0,0 +1,59 @@
+package vt100
+
+import "testing"
+
+func TestCommands(t *testing.T) {
+	for _, tc := range []struct {
+		got, want string
+	}{
+		{CursorUp(3), "\033[3A"},
+		{CursorPosition(0, 4), "\033[5;1H"},
+		{EraseLine(EraseAll), "\033[2K"},
+		{EraseDisplay(EraseToEnd), "\033[J"},
+		{EraseLine(EraseToStart), "\033[1K"},
+		{EraseDisplay(EraseMode(3)), ""},
+		{SGR(1, 31), "\033[1;31m"},
+		{Get("Cursor Home", map[string]string{"{ROW};{COLUMN}": ""}), "\033[H"},
+		{Get("Cursor Home", map[string]string{"{ROW}": "2", "{COLUMN}": "3"}), "\033[2;3H"},
+		{Get("Cursor Up", nil), "\033[A"},
+		{Get("Set Attribute Mode", map[string]string{"{attr1};...;{attrn}": "0"}), "\033[0m"},
+		{Get("Scroll Screen", nil), "\033[r"},
+		{Get("No Such Command", nil), ""},
+		{Get("Cursor", nil), ""}, // only exact names are looked up
+		{AttributeOrColor("Red"), "\033[31m"},
+		{AttributeAndColor("Bright", "Blue"), "\033[1;34m"},
+		{AttributeOrColor("Italic"), "\033[3m"},
+		{AttributeAndColor("Curly underline", "Red"), "\033[4:3;31m"},
+		{AttributeNumber("Overline"), "53"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+	if _, err := LookupCommand("Cursor Upp"); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+	// Changing a copy does not change the command that is used
+	for _, cmd := range Commands() {
+		if len(cmd.Params) > 0 {
+			cmd.Params[0] = "CHANGED"
+		}
+	}
+	if cmd, _ := LookupCommand("Scroll Region"); cmd.Params[0] != "START" {
+		t.Errorf("the parameters were changed: %q", cmd.Params)
+	}
+	cmd, err := LookupCommand("Scroll Region")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cmd.Sequence(2, 10), "\033[2;10r"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	names := make(map[string]bool)
+	for _, cmd := range Commands() {
+		if names[cmd.Name] {
+			t.Errorf("the command %q is defined twice", cmd.Name)
+		}
+		names[cmd.Name] = true
+	}
+}
@@ -0,0 +1,214 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrStop can be returned by the function that handles the events, for stopping the EventLoop
+var ErrStop = errors.New("stop the event loop")
+
+// inputTimeout is how long the event loop waits for input before checking if it should stop
+const inputTimeout = 100 * time.Millisecond
+
+// EventLoop reads key presses, mouse events and pasted text from a TTY and delivers them,
+// together with resize events, timer ticks and posted events, to a function that runs on
+// the goroutine that called Run. The events are handled one at a time, so the function
+// can update and draw canvases without any locking. Example:
+//
+//	loop := vt100.NewEventLoop(tty)
+//	loop.SetTick(50 * time.Millisecond)
+//	err := loop.Run(ctx, func(e vt100.Event) error {
+//		switch e := e.(type) {
+//		case vt100.KeyEvent:
+//			if e.Rune == 'q' {
+//				return vt100.ErrStop
+//			}
+//		case vt100.ResizeEvent:
+//			c.ResizeTo(e.W, e.H)
+//		case vt100.TickEvent:
+//			c.Draw()
+//		}
+//		return nil
+//	})
+type EventLoop struct {
+	tty    *TTY
+	mut    *sync.Mutex
+	posted []Event       // events that have been posted, but not handled yet
+	wake   chan struct{} // receives a value when an event is posted
+	tick   time.Duration // the interval between ticks, or 0 for no ticks
+	mouse  bool          // should mouse tracking be enabled while running?
+	paste  bool          // should bracketed paste be enabled while running?
+}
+
+// NewEventLoop creates a new EventLoop that reads input from the given TTY.
+// The TTY should not be read from by anything else while the loop is running.
+func NewEventLoop(tty *TTY) *EventLoop {
+	return &EventLoop{tty: tty, mut: &sync.Mutex{}, wake: make(chan struct{}, 1)}
+}
+
+// SetTick makes the loop deliver a TickEvent at the given interval, for animations and
+// for games that should update at a steady pace. 0 turns the ticks off, which is the default.
+// It must be called before Run.
+func (l *EventLoop) SetTick(d time.Duration) {
+	l.tick = d
+}
+
+// EnableMouse makes the loop enable mouse tracking while it is running, so that mouse
+// button presses, releases, wheel movements and movements while a button is held down are
+// delivered as MouseEvents. It must be called before Run.
+func (l *EventLoop) EnableMouse(enable bool) {
+	l.mouse = enable
+}
+
+// EnableBracketedPaste makes the loop enable bracketed paste while it is running, so that
+// pasted text is delivered as one PasteEvent, instead of one KeyEvent per character.
+// It must be called before Run.
+func (l *EventLoop) EnableBracketedPaste(enable bool) {
+	l.paste = enable
+}
+
+// Post adds an event to the events that are delivered by the loop, like the result of
+// work that has been done in another goroutine. It can be called from any goroutine,
+// also from the function that handles the events, and it never blocks.
+func (l *EventLoop) Post(e Event) {
+	l.mut.Lock()
+	l.posted = append(l.posted, e)
+	l.mut.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextPosted removes and returns the first posted event, if there is one
+func (l *EventLoop) nextPosted() (Event, bool) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if len(l.posted) == 0 {
+		return nil, false
+	}
+	e := l.posted[0]
+	l.posted = l.posted[1:]
+	if len(l.posted) > 0 {
+		// Make sure that the loop comes back for the rest
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+	return e, true
+}
+
+// Run delivers events to the given function, one at a time, until the context is done,
+// the function returns an error or reading from the TTY fails. If the function returns
+// ErrStop, Run returns nil. Otherwise the error, or the error of the context, is returned.
+// Before Run returns, the reading from the TTY has stopped and the TTY settings are restored.
+func (l *EventLoop) Run(ctx context.Context, handle func(Event) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	input := make(chan Event)
+	readErr := make(chan error, 1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		readErr <- l.read(ctx, input)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	if l.mouse {
+		l.tty.WriteString(cmdEnableMouse.Sequence())
+		defer l.tty.WriteString(cmdDisableMouse.Sequence())
+	}
+	if l.paste {
+		l.tty.WriteString(cmdEnablePaste.Sequence())
+		defer l.tty.WriteString(cmdDisablePaste.Sequence())
+	}
+
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+
+	var ticks <-chan time.Time
+	if l.tick > 0 {
+		ticker := time.NewTicker(l.tick)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err = <-readErr:
+			return err
+		case e := <-input:
+			err = handle(e)
+		case <-resized:
+			w, h := MustTermSize()
+			err = handle(ResizeEvent{w, h})
+		case t := <-ticks:
+			err = handle(TickEvent{t})
+		case <-l.wake:
+			if e, ok := l.nextPosted(); ok {
+				err = handle(e)
+			}
+		}
+		if err == ErrStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read reads and decodes input from the TTY and sends the events on the given channel,
+// until the context is done or reading fails. Events that have been read by the TTY,
+// but not returned yet, are sent first.
+func (l *EventLoop) read(ctx context.Context, events chan<- Event) error {
+	l.tty.RawMode()
+	defer func() {
+		l.tty.t.SetReadTimeout(l.tty.timeout)
+		l.tty.Restore()
+	}()
+	buf := make([]byte, 4096)
+	for {
+		for len(l.tty.events) > 0 {
+			select {
+			case events <- l.tty.events[0]:
+				l.tty.events = l.tty.events[1:]
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		timeout := inputTimeout
+		if l.tty.input.waiting() {
+			timeout = escapeTimeout
+		}
+		l.tty.t.SetReadTimeout(timeout)
+		n, err := l.tty.t.Read(buf)
+		if err != nil && err != io.EOF {
+			// io.EOF means that the read timed out
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// If nothing more has arrived, an incomplete escape sequence is not going to be completed
+		l.tty.events = append(l.tty.events, l.tty.input.parse(buf[:n], n == 0)...)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/term"
+	"github.com/pkg/term/termios"
+)
+
+// newTestTTY opens a pseudo terminal, and returns a TTY for it together with the other
+// end of it, which input can be written to
+func newTestTTY(t *testing.T) (*TTY, *os.File) {
+	ptm, pts, err := termios.Pty()
+	if err != nil {
+		t.Skip("no pty:", err)
+	}
+	t.Cleanup(func() {
+		ptm.Close()
+		pts.Close()
+	})
+	tt, err := term.Open(pts.Name())
+	if err != nil {
+		t.Skip("could not open the pty:", err)
+	}
+	tty := &TTY{t: tt, timeout: defaultTimeout}
+	t.Cleanup(tty.Close)
+	return tty, ptm
+}
+
+func TestEventLoop(t *testing.T) {
+	tty, ptm := newTestTTY(t)
+	loop := NewEventLoop(tty)
+	loop.EnableBracketedPaste(true)
+	type done struct{}
+	var got []Event
+	ptm.WriteString("q\033[A\033[200~pasted\033[201~\033")
+	err := loop.Run(context.Background(), func(e Event) error {
+		if _, ok := e.(done); ok {
+			return ErrStop
+		}
+		got = append(got, e)
+		if e == escKey {
+			loop.Post("posted")
+			loop.Post(done{})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{KeyEvent{Rune: 'q'}, KeyEvent{Key: KeyUp}, PasteEvent{"pasted"}, escKey, "posted"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The loop stops when the context is done, or when the function returns an error
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := loop.Run(ctx, func(Event) error { return nil }); err != context.DeadlineExceeded {
+		t.Errorf("expected the context error, got %v", err)
+	}
+	errTest := errors.New("test")
+	loop.SetTick(time.Millisecond)
+	if err := loop.Run(context.Background(), func(e Event) error {
+		if _, ok := e.(TickEvent); !ok {
+			t.Errorf("expected a tick, got %v", e)
+		}
+		return errTest
+	}); err != errTest {
+		t.Errorf("expected the error from the function, got %v", err)
+	}
+}
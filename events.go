@@ -0,0 +1,54 @@
+package vt100
+
+import "time"
+
+// Event is something that an EventLoop delivers: a KeyEvent, MouseEvent, PasteEvent,
+// ResizeEvent or TickEvent, or any other value that has been posted with EventLoop.Post
+type Event any
+
+// MouseButton is a mouse button, or a direction the mouse wheel was turned in
+type MouseButton int
+
+const (
+	MouseNone MouseButton = iota // no button, for mouse movements
+	MouseLeft
+	MouseMiddle
+	MouseRight
+	MouseWheelUp
+	MouseWheelDown
+	MouseWheelLeft
+	MouseWheelRight
+)
+
+// MouseAction is what was done with a mouse button
+type MouseAction int
+
+const (
+	MousePress MouseAction = iota // a button was pressed, or the wheel was turned
+	MouseRelease
+	MouseMotion // the mouse was moved, with Button held down
+)
+
+// MouseEvent is a mouse button press, release or movement, at the given cell (0,0 is top left).
+// Mouse events are only reported if mouse tracking has been enabled, see EventLoop.EnableMouse.
+type MouseEvent struct {
+	X, Y   uint
+	Button MouseButton
+	Action MouseAction
+	Mods   Mods // Shift, Alt and Ctrl, if the terminal reports them
+}
+
+// PasteEvent is text that has been pasted into the terminal. Pasted text is only reported
+// like this if bracketed paste has been enabled, see EventLoop.EnableBracketedPaste.
+// Otherwise, it arrives as one KeyEvent per character.
+type PasteEvent struct {
+	Text string
+}
+
+// ResizeEvent is the new size of the terminal, after it has been resized
+type ResizeEvent Size
+
+// TickEvent is sent at regular intervals, see EventLoop.SetTick
+type TickEvent struct {
+	Time time.Time
+}
@@ -0,0 +1,196 @@
+package vt100
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// graphemeProperty is the Grapheme_Cluster_Break property of a rune, from UAX #29
+type graphemeProperty uint8
+
+const (
+	gpOther graphemeProperty = iota
+	gpCR
+	gpLF
+	gpControl
+	gpExtend
+	gpZWJ
+	gpRegionalIndicator
+	gpPrepend
+	gpSpacingMark
+	gpL
+	gpV
+	gpT
+	gpLV
+	gpLVT
+	gpExtendedPictographic
+)
+
+// prependRanges lists the runes that have the Prepend property
+var prependRanges = []runeRange{
+	{0x0600, 0x0605}, {0x06DD, 0x06DD}, {0x070F, 0x070F}, {0x0890, 0x0891},
+	{0x08E2, 0x08E2}, {0x0D4E, 0x0D4E}, {0x110BD, 0x110BD}, {0x110CD, 0x110CD},
+	{0x111C2, 0x111C3}, {0x1193F, 0x1193F}, {0x11941, 0x11941}, {0x11A3A, 0x11A3A},
+	{0x11A84, 0x11A89}, {0x11D46, 0x11D46}, {0x11F02, 0x11F02},
+}
+
+// pictographicRanges lists the runes that have the Extended_Pictographic property
+var pictographicRanges = []runeRange{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21A9, 0x21AA},
+	{0x231A, 0x231B}, {0x2328, 0x2328}, {0x2388, 0x2388}, {0x23CF, 0x23CF},
+	{0x23E9, 0x23F3}, {0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB},
+	{0x25B6, 0x25B6}, {0x25C0, 0x25C0}, {0x25FB, 0x25FE}, {0x2600, 0x2605},
+	{0x2607, 0x2612}, {0x2614, 0x2685}, {0x2690, 0x2705}, {0x2708, 0x2712},
+	{0x2714, 0x2714}, {0x2716, 0x2716}, {0x271D, 0x271D}, {0x2721, 0x2721},
+	{0x2728, 0x2728}, {0x2733, 0x2734}, {0x2744, 0x2744}, {0x2747, 0x2747},
+	{0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755}, {0x2757, 0x2757},
+	{0x2763, 0x2767}, {0x2795, 0x2797}, {0x27A1, 0x27A1}, {0x27B0, 0x27B0},
+	{0x27BF, 0x27BF}, {0x2934, 0x2935}, {0x2B05, 0x2B07}, {0x2B1B, 0x2B1C},
+	{0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x3030, 0x3030}, {0x303D, 0x303D},
+	{0x3297, 0x3297}, {0x3299, 0x3299}, {0x1F000, 0x1F0FF}, {0x1F10D, 0x1F10F},
+	{0x1F12F, 0x1F12F}, {0x1F16C, 0x1F171}, {0x1F17E, 0x1F17F}, {0x1F18E, 0x1F18E},
+	{0x1F191, 0x1F19A}, {0x1F1AD, 0x1F1E5}, {0x1F201, 0x1F20F}, {0x1F21A, 0x1F21A},
+	{0x1F22F, 0x1F22F}, {0x1F232, 0x1F23A}, {0x1F23C, 0x1F23F}, {0x1F249, 0x1F3FA},
+	{0x1F400, 0x1F53D}, {0x1F546, 0x1F64F}, {0x1F680, 0x1F6FF}, {0x1F774, 0x1F77F},
+	{0x1F7D5, 0x1F7FF}, {0x1F80C, 0x1F80F}, {0x1F848, 0x1F84F}, {0x1F85A, 0x1F85F},
+	{0x1F888, 0x1F88F}, {0x1F8AE, 0x1F8FF}, {0x1F90C, 0x1F93A}, {0x1F93C, 0x1F945},
+	{0x1F947, 0x1FAFF}, {0x1FC00, 0x1FFFD},
+}
+
+// graphemePropertyOf returns the Grapheme_Cluster_Break property of the given rune
+func graphemePropertyOf(r rune) graphemeProperty {
+	switch {
+	case r == '\r':
+		return gpCR
+	case r == '\n':
+		return gpLF
+	case r < 0x20 || (0x7F <= r && r < 0xA0):
+		return gpControl
+	case r < 0xA9:
+		return gpOther
+	case r == 0x200D:
+		return gpZWJ
+	case 0x1F1E6 <= r && r <= 0x1F1FF:
+		return gpRegionalIndicator
+	case 0x1F3FB <= r && r <= 0x1F3FF:
+		// Emoji modifiers (skin tones)
+		return gpExtend
+	case (0x1100 <= r && r <= 0x115F) || (0xA960 <= r && r <= 0xA97C):
+		return gpL
+	case (0x1160 <= r && r <= 0x11A7) || (0xD7B0 <= r && r <= 0xD7C6):
+		return gpV
+	case (0x11A8 <= r && r <= 0x11FF) || (0xD7CB <= r && r <= 0xD7FB):
+		return gpT
+	case 0xAC00 <= r && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return gpLV
+		}
+		return gpLVT
+	case inRanges(r, prependRanges):
+		return gpPrepend
+	case r == 0x200C || unicode.In(r, unicode.Mn, unicode.Me, unicode.Other_Grapheme_Extend):
+		return gpExtend
+	case r == 0x2028 || r == 0x2029 || unicode.Is(unicode.Cf, r):
+		return gpControl
+	case r == 0x0E33 || r == 0x0EB3 || unicode.Is(unicode.Mc, r):
+		return gpSpacingMark
+	case inRanges(r, pictographicRanges):
+		return gpExtendedPictographic
+	}
+	return gpOther
+}
+
+// graphemeBreak checks if there is a grapheme cluster boundary between two runes
+// with the given properties. riCount is the number of regional indicators that
+// directly precede the second rune, and emoji is true if the runes before the
+// second rune are an extended pictographic rune, any Extend runes and a ZWJ.
+func graphemeBreak(prev, next graphemeProperty, riCount int, emoji bool) bool {
+	switch {
+	case prev == gpCR && next == gpLF: // GB3
+		return false
+	case prev == gpCR || prev == gpLF || prev == gpControl: // GB4
+		return true
+	case next == gpCR || next == gpLF || next == gpControl: // GB5
+		return true
+	case prev == gpL && (next == gpL || next == gpV || next == gpLV || next == gpLVT): // GB6
+		return false
+	case (prev == gpLV || prev == gpV) && (next == gpV || next == gpT): // GB7
+		return false
+	case (prev == gpLVT || prev == gpT) && next == gpT: // GB8
+		return false
+	case next == gpExtend || next == gpZWJ || next == gpSpacingMark: // GB9, GB9a
+		return false
+	case prev == gpPrepend: // GB9b
+		return false
+	case emoji && next == gpExtendedPictographic: // GB11
+		return false
+	case prev == gpRegionalIndicator && next == gpRegionalIndicator: // GB12, GB13
+		return riCount%2 == 0
+	}
+	return true // GB999
+}
+
+// nextGrapheme splits the first extended grapheme cluster from the given string,
+// as described in Unicode Standard Annex #29. Returns the cluster and the rest of the string.
+func nextGrapheme(s string) (string, string) {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return "", ""
+	}
+	prev := graphemePropertyOf(r)
+	riCount := 0
+	if prev == gpRegionalIndicator {
+		riCount = 1
+	}
+	pictographic := prev == gpExtendedPictographic // an extended pictographic rune followed by Extend*
+	emoji := false                                 // the above, followed by ZWJ
+	for size < len(s) {
+		r, n := utf8.DecodeRuneInString(s[size:])
+		next := graphemePropertyOf(r)
+		if graphemeBreak(prev, next, riCount, emoji) {
+			break
+		}
+		size += n
+		switch next {
+		case gpRegionalIndicator:
+			riCount++
+		case gpExtendedPictographic:
+			pictographic = true
+		case gpZWJ:
+			emoji = pictographic
+			pictographic = false
+		case gpExtend:
+			emoji = false
+		default:
+			pictographic, emoji = false, false
+		}
+		if next != gpRegionalIndicator {
+			riCount = 0
+		}
+		prev = next
+	}
+	return s[:size], s[size:]
+}
+
+// clusterWidth returns the number of terminal columns that the given grapheme cluster occupies.
+// This is the width of the first rune, except that emoji presentation sequences and
+// flags (pairs of regional indicators) are always 2 columns wide.
+func clusterWidth(cluster string) int {
+	r, size := utf8.DecodeRuneInString(cluster)
+	width := RuneWidth(r)
+	if size == len(cluster) || width == 0 {
+		return width
+	}
+	if graphemePropertyOf(r) == gpRegionalIndicator {
+		if r2, _ := utf8.DecodeRuneInString(cluster[size:]); graphemePropertyOf(r2) == gpRegionalIndicator {
+			return 2
+		}
+	}
+	for _, r := range cluster[size:] {
+		if r == 0xFE0F { // emoji presentation selector
+			return 2
+		}
+	}
+	return width
+}
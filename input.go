@@ -0,0 +1,392 @@
+package vt100
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// escapeTimeout is how long to wait for the rest of an escape sequence. If nothing more
+// arrives within this time, a lone ESC is the Esc key, and ESC followed by a key is that
+// key together with Alt. Terminals measure read timeouts in tenths of a second, so it
+// may be rounded up.
+const escapeTimeout = 50 * time.Millisecond
+
+// The sequences that surround pasted text, when bracketed paste is enabled
+var (
+	pasteStart = []byte("\033[200~")
+	pasteEnd   = []byte("\033[201~")
+)
+
+// escKey is the Esc key, which is also the first byte of every escape sequence
+var escKey = KeyEvent{Key: KeyEscape}
+
+// letterKeys are the keys that are sent as ESC [ or ESC O followed by a letter, like
+// ESC [ A for Up. With modifiers, ESC [ 1 ; 5 A is sent, for Ctrl-Up.
+var letterKeys = map[byte]Key{
+	'A': KeyUp,
+	'B': KeyDown,
+	'C': KeyRight,
+	'D': KeyLeft,
+	'H': KeyHome,
+	'F': KeyEnd,
+	'P': KeyF1,
+	'Q': KeyF2,
+	'R': KeyF3,
+	'S': KeyF4,
+	'Z': KeyBackTab,
+}
+
+// tildeKeys are the keys that are sent as ESC [ followed by a number and ~, like
+// ESC [ 5 ~ for Page Up, by the VT220, xterm, rxvt and the Linux console.
+// With modifiers, ESC [ 5 ; 5 ~ is sent, for Ctrl-Page Up.
+var tildeKeys = map[int]Key{
+	1:  KeyHome,
+	2:  KeyInsert,
+	3:  KeyDelete,
+	4:  KeyEnd,
+	5:  KeyPageUp,
+	6:  KeyPageDown,
+	7:  KeyHome,
+	8:  KeyEnd,
+	11: KeyF1,
+	12: KeyF2,
+	13: KeyF3,
+	14: KeyF4,
+	15: KeyF5,
+	17: KeyF6,
+	18: KeyF7,
+	19: KeyF8,
+	20: KeyF9,
+	21: KeyF10,
+	23: KeyF11,
+	24: KeyF12,
+	25: KeyF13,
+	26: KeyF14,
+	28: KeyF15,
+	29: KeyF16,
+	31: KeyF17,
+	32: KeyF18,
+	33: KeyF19,
+	34: KeyF20,
+}
+
+// rxvtMods are the modifiers that rxvt reports by replacing the ~ at the end of a key
+// sequence, like ESC [ 5 ^ for Ctrl-Page Up
+var rxvtMods = map[byte]Mods{
+	'~': 0,
+	'$': ModShift,
+	'^': ModCtrl,
+	'@': ModCtrl | ModShift,
+}
+
+// The kitty keyboard protocol uses code points in the private use area for the keys that
+// do not type a character, from kittyFirst to kittyLast. F13 to F35 start at kittyF13.
+const (
+	kittyFirst = 57344
+	kittyF13   = 57376
+	kittyLast  = 57454
+)
+
+// inputParser turns the input from a terminal into events, as it is read. Input that
+// ends with an escape sequence, UTF-8 rune or pasted text that is not complete is kept,
+// until the rest of it has been read.
+type inputParser struct {
+	pending []byte
+}
+
+// parse adds the given input to the input that is kept, and returns the events that
+// are complete, in order. If flush is true, an escape sequence that is not complete is
+// taken to be key presses instead, like the Esc key or Alt-[.
+func (p *inputParser) parse(b []byte, flush bool) []Event {
+	p.pending = append(p.pending, b...)
+	events, used := decodeInput(p.pending, flush)
+	p.pending = p.pending[:copy(p.pending, p.pending[used:])]
+	return events
+}
+
+// waiting returns true if the parser is waiting for the rest of an escape sequence,
+// UTF-8 rune or pasted text
+func (p *inputParser) waiting() bool {
+	return len(p.pending) > 0
+}
+
+// decodeInput decodes the key presses, mouse events and pasted text at the start of
+// the given input, and returns them together with the number of bytes that were used.
+// An escape sequence or UTF-8 rune at the end of the input that is not complete is left,
+// so that it can be completed by the next read, unless flush is true. The same goes for
+// pasted text, where the text that has been read is a PasteEvent if flush is true.
+func decodeInput(b []byte, flush bool) ([]Event, int) {
+	var events []Event
+	i := 0
+	for i < len(b) {
+		e, n := decodeEvent(b[i:], flush)
+		if n == 0 {
+			break
+		}
+		if e != nil {
+			events = append(events, e)
+		}
+		i += n
+	}
+	return events, i
+}
+
+// decodeEvent decodes the first event in the given input, and returns it together with
+// the number of bytes that were used. The event is nil for input that is skipped, like
+// escape sequences that are not known. 0 bytes are used if the input is not complete.
+func decodeEvent(b []byte, flush bool) (Event, int) {
+	if b[0] != 27 {
+		return decodeRune(b, flush)
+	}
+	switch {
+	case len(b) == 1:
+		if flush {
+			return escKey, 1
+		}
+		return nil, 0
+	case len(b) == 2 && (b[1] == '[' || b[1] == 'O'):
+		if flush {
+			// Nothing followed, so this was Alt-[ or Alt-O
+			return KeyEvent{Rune: rune(b[1]), Mods: ModAlt}, 2
+		}
+		return nil, 0
+	case b[1] == '[':
+		return decodeCSI(b, flush)
+	case b[1] == 'O':
+		return decodeSS3(b[2]), 3
+	case b[1] == ']' || b[1] == 'P' || b[1] == '_' || b[1] == '^' || b[1] == 'X':
+		return decodeString(b, flush)
+	}
+	// ESC in front of a key means that Alt was held down
+	e, n := decodeEvent(b[1:], flush)
+	if n == 0 {
+		return nil, 0
+	}
+	if ke, ok := e.(KeyEvent); ok {
+		ke.Mods |= ModAlt
+		return ke, n + 1
+	}
+	return escKey, 1
+}
+
+// decodeRune decodes a typed character or control character
+func decodeRune(b []byte, flush bool) (Event, int) {
+	if b[0] < utf8.RuneSelf {
+		return keyEventFromByte(b[0]), 1
+	}
+	if !utf8.FullRune(b) && !flush {
+		return nil, 0
+	}
+	r, size := utf8.DecodeRune(b)
+	if r == utf8.RuneError && size <= 1 {
+		// Not UTF-8, skip the byte
+		return nil, 1
+	}
+	return KeyEvent{Rune: r}, size
+}
+
+// decodeSS3 decodes an escape sequence that starts with ESC O, which is sent for the
+// arrow keys, Home, End and F1 to F4 by some terminals
+func decodeSS3(final byte) Event {
+	switch {
+	case final == 'M':
+		// Enter on the numeric keypad
+		return KeyEvent{Key: KeyEnter}
+	case 'a' <= final && final <= 'd':
+		// Ctrl and an arrow key, in rxvt
+		return KeyEvent{Key: letterKeys[final-'a'+'A'], Mods: ModCtrl}
+	}
+	if key, ok := letterKeys[final]; ok {
+		return KeyEvent{Key: key}
+	}
+	return nil
+}
+
+// decodeString skips an OSC, DCS, APC, PM or SOS sequence, which starts with ESC ], ESC P,
+// ESC _, ESC ^ or ESC X and ends with ESC \. OSC sequences may also end with BEL.
+// These are sent by the terminal as replies, like the reply to a query for the
+// background color, and are not key presses.
+func decodeString(b []byte, flush bool) (Event, int) {
+	for i := 2; i < len(b); i++ {
+		switch {
+		case b[i] == 7 && b[1] == ']':
+			return nil, i + 1
+		case b[i] == 27 && i+1 < len(b) && b[i+1] == '\\':
+			return nil, i + 2
+		}
+	}
+	if flush {
+		// The end never arrived, so this was Alt and a key, like Alt-]
+		return KeyEvent{Rune: rune(b[1]), Mods: ModAlt}, 2
+	}
+	return nil, 0
+}
+
+// decodeCSI decodes an escape sequence that starts with ESC [, like the arrow keys,
+// Page Up, mouse events and the start of pasted text
+func decodeCSI(b []byte, flush bool) (Event, int) {
+	// The parameter and intermediate bytes are followed by one final byte
+	end := 2
+	for end < len(b) && 0x20 <= b[end] && b[end] <= 0x3f {
+		end++
+	}
+	if end == len(b) {
+		if flush {
+			return escKey, 1
+		}
+		return nil, 0
+	}
+	final := b[end]
+	if final < 0x40 || final > 0x7e {
+		// Not a valid escape sequence
+		return escKey, 1
+	}
+	n := end + 1
+	params := string(b[2:end])
+	switch {
+	case bytes.Equal(b[:n], pasteStart):
+		text, _, found := bytes.Cut(b[n:], pasteEnd)
+		if !found {
+			if flush {
+				// The end never arrived, so the text that has been read is all there is
+				return PasteEvent{Text: string(b[n:])}, len(b)
+			}
+			return nil, 0
+		}
+		return PasteEvent{Text: string(text)}, n + len(text) + len(pasteEnd)
+	case strings.HasPrefix(params, "<") && (final == 'M' || final == 'm'):
+		return decodeMouse(params[1:], final == 'm'), n
+	case final == '[' && params == "":
+		// F1 to F5 in the Linux console are ESC [ [ A to ESC [ [ E
+		if len(b) == n {
+			if flush {
+				return KeyEvent{Rune: '[', Mods: ModAlt}, n
+			}
+			return nil, 0
+		}
+		if 'A' <= b[n] && b[n] <= 'E' {
+			return KeyEvent{Key: KeyF1 + Key(b[n]-'A')}, n + 1
+		}
+		return nil, n
+	}
+	return decodeKeySequence(params, final), n
+}
+
+// csiParams returns the numbers in the parameters of an escape sequence, like 1 and 5
+// for "1;5". Sub-parameters, like the :1 in "1;5:1", are left out. Parameters that are
+// empty or not numbers are 0.
+func csiParams(params string) []int {
+	if params == "" {
+		return nil
+	}
+	fields := strings.Split(params, ";")
+	numbers := make([]int, len(fields))
+	for i, field := range fields {
+		field, _, _ = strings.Cut(field, ":")
+		numbers[i], _ = strconv.Atoi(field)
+	}
+	return numbers
+}
+
+// decodeKeySequence decodes the key that is sent as ESC [, the given parameters and the
+// given final byte. Returns nil if the key is not known.
+func decodeKeySequence(params string, final byte) Event {
+	numbers := csiParams(params)
+	param := func(i int) int {
+		if i < len(numbers) {
+			return numbers[i]
+		}
+		return 0
+	}
+	switch {
+	case final == 'u':
+		// The kitty keyboard protocol and fixterms: ESC [ code point ; modifiers u
+		return keyEventFromCodePoint(param(0), modsFromParam(param(1)))
+	case final == '~' && param(0) == 27:
+		// xterm with modifyOtherKeys: ESC [ 27 ; modifiers ; code point ~
+		return keyEventFromCodePoint(param(2), modsFromParam(param(1)))
+	case 'a' <= final && final <= 'd' && params == "":
+		// Shift and an arrow key, in rxvt
+		return KeyEvent{Key: letterKeys[final-'a'+'A'], Mods: ModShift}
+	}
+	if key, ok := letterKeys[final]; ok {
+		return KeyEvent{Key: key, Mods: modsFromParam(param(1))}
+	}
+	if mods, ok := rxvtMods[final]; ok {
+		if key, ok := tildeKeys[param(0)]; ok {
+			return KeyEvent{Key: key, Mods: mods | modsFromParam(param(1))}
+		}
+	}
+	return nil
+}
+
+// keyEventFromCodePoint returns the key event for a key that is reported as a Unicode
+// code point, like 13 for Enter, together with the given modifiers
+func keyEventFromCodePoint(cp int, mods Mods) Event {
+	var e KeyEvent
+	switch {
+	case cp <= 0 || cp > utf8.MaxRune:
+		return nil
+	case cp < 128:
+		e = keyEventFromByte(byte(cp))
+	case kittyF13 <= cp && cp <= kittyF13+int(KeyF24-KeyF13):
+		e = KeyEvent{Key: KeyF13 + Key(cp-kittyF13)}
+	case kittyFirst <= cp && cp <= kittyLast:
+		// Other keys that the kitty keyboard protocol reports, like media keys
+		return nil
+	default:
+		e = KeyEvent{Rune: rune(cp)}
+	}
+	e.Mods |= mods
+	return e
+}
+
+// decodeMouse decodes the parameters of an SGR mouse event, like "0;12;5" for a left click
+// at column 12 and row 5. Returns nil if the parameters are not valid.
+func decodeMouse(params string, release bool) Event {
+	fields := strings.Split(params, ";")
+	if len(fields) != 3 {
+		return nil
+	}
+	var values [3]int
+	for i, field := range fields {
+		v, err := strconv.Atoi(field)
+		if err != nil || v < 0 {
+			return nil
+		}
+		values[i] = v
+	}
+	code, x, y := values[0], values[1], values[2]
+	if x < 1 || y < 1 || code&128 != 0 {
+		// The extra buttons, like back and forward, are not reported
+		return nil
+	}
+	e := MouseEvent{X: uint(x - 1), Y: uint(y - 1)}
+	switch {
+	case code&64 != 0:
+		e.Button = MouseWheelUp + MouseButton(code&3)
+	case code&3 == 3:
+		e.Button = MouseNone
+	default:
+		e.Button = MouseLeft + MouseButton(code&3)
+	}
+	switch {
+	case release:
+		e.Action = MouseRelease
+	case code&32 != 0:
+		e.Action = MouseMotion
+	}
+	if code&4 != 0 {
+		e.Mods |= ModShift
+	}
+	if code&8 != 0 {
+		e.Mods |= ModAlt
+	}
+	if code&16 != 0 {
+		e.Mods |= ModCtrl
+	}
+	return e
+}
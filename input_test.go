@@ -0,0 +1,114 @@
+package vt100
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeInput(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		flush bool
+		want  []Event
+		used  int
+	}{
+		{"aö\r\t\x7f\x01", false, []Event{KeyEvent{Rune: 'a'}, KeyEvent{Rune: 'ö'}, KeyEvent{Key: KeyEnter}, KeyEvent{Key: KeyTab}, KeyEvent{Key: KeyBackspace}, KeyEvent{Rune: 'a', Mods: ModCtrl}}, 7},
+		{"\033[A\033[5~\033[2;5~\033OH", false, []Event{KeyEvent{Key: KeyUp}, KeyEvent{Key: KeyPageUp}, KeyEvent{Key: KeyInsert, Mods: ModCtrl}, KeyEvent{Key: KeyHome}}, 16},
+		{"x\033", false, []Event{KeyEvent{Rune: 'x'}}, 1},
+		{"x\033", true, []Event{KeyEvent{Rune: 'x'}, escKey}, 2},
+		{"\033[", true, []Event{KeyEvent{Rune: '[', Mods: ModAlt}}, 2},
+		{"\033[1", false, nil, 0},
+		{"\033[99zq", false, []Event{KeyEvent{Rune: 'q'}}, 6},
+		{"\xc3", false, nil, 0},
+		{"\033[<0;3;4M\033[<0;3;4m", false, []Event{MouseEvent{X: 2, Y: 3, Button: MouseLeft}, MouseEvent{X: 2, Y: 3, Button: MouseLeft, Action: MouseRelease}}, 18},
+		{"\033[<34;1;1M\033[<65;10;2M\033[<51;5;5M", false, []Event{MouseEvent{0, 0, MouseRight, MouseMotion, 0}, MouseEvent{9, 1, MouseWheelDown, MousePress, 0}, MouseEvent{4, 4, MouseNone, MouseMotion, ModCtrl}}, 31},
+		{"\033[200~hi\033[A\r\033[201~!", false, []Event{PasteEvent{"hi\033[A\r"}, KeyEvent{Rune: '!'}}, 19},
+		{"a\033[200~incomplete", false, []Event{KeyEvent{Rune: 'a'}}, 1},
+		{"a\033[200~incomplete", true, []Event{KeyEvent{Rune: 'a'}, PasteEvent{"incomplete"}}, 17},
+	} {
+		got, used := decodeInput([]byte(tc.input), tc.flush)
+		if !reflect.DeepEqual(got, tc.want) || used != tc.used {
+			t.Errorf("%q: got %v (%d bytes), want %v (%d bytes)", tc.input, got, used, tc.want, tc.used)
+		}
+	}
+}
+
+func TestKeyEvents(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		name  string
+		code  int
+	}{
+		{"\033[1;5A", "Ctrl+Up", 253},
+		{"\033[15;2~", "Shift+F5", 0},
+		{"\033[1;2P", "Shift+F1", 0},
+		{"\033OQ", "F2", 0},
+		{"\033[[E", "F5", 0},
+		{"\033[24~", "F12", 0},
+		{"\033[34~", "F20", 0},
+		{"\033[57387u", "F24", 0},
+		{"\033[Z", "BackTab", 0},
+		{"\033[3;3~", "Alt+Delete", 0},
+		{"\033[5^", "Ctrl+PgUp", 251},
+		{"\033Oa", "Ctrl+Up", 253},
+		{"\033[97;5u", "Ctrl+a", 1},
+		{"\033[27;3;13~", "Alt+Enter", 13},
+		{"\033x", "Alt+x", 'x'},
+		{"\033\033[B", "Alt+Down", 255},
+		{"\x00", "Ctrl+Space", 0},
+		{"\x1c", "Ctrl+\\", 28},
+		{"\033[4~", "End", 5},
+		{"\033[6~", "PgDn", 250},
+	} {
+		events, _ := decodeInput([]byte(tc.input), true)
+		if len(events) != 1 {
+			t.Errorf("%q: expected one event, got %v", tc.input, events)
+			continue
+		}
+		e, ok := events[0].(KeyEvent)
+		if !ok || e.String() != tc.name || e.Code() != tc.code {
+			t.Errorf("%q: got %v (%q, code %d), want %q (code %d)", tc.input, events[0], e.String(), e.Code(), tc.name, tc.code)
+		}
+	}
+}
+
+func TestInputParser(t *testing.T) {
+	input := "x\033[15;2~\033]11;rgb:ffff/ffff/ffff\033\\\033P1$r0m\033\\ø\033]0;title\a\033[<0;1;1M\033[1;5A"
+	want := []Event{
+		KeyEvent{Rune: 'x'},
+		KeyEvent{Key: KeyF5, Mods: ModShift},
+		KeyEvent{Rune: 'ø'},
+		MouseEvent{Button: MouseLeft},
+		KeyEvent{Key: KeyUp, Mods: ModCtrl},
+	}
+	// The events are the same, no matter how the input is split up when it is read
+	for _, size := range []int{1, 2, 3, 7, len(input)} {
+		var p inputParser
+		var got []Event
+		for i := 0; i < len(input); i += size {
+			got = append(got, p.parse([]byte(input[i:min(i+size, len(input))]), false)...)
+		}
+		if !reflect.DeepEqual(got, want) || p.waiting() {
+			t.Errorf("read %d bytes at a time: got %v, want %v", size, got, want)
+		}
+	}
+	// An escape sequence that is not complete is kept, until it is flushed
+	var p inputParser
+	if got := p.parse([]byte("\033]"), false); got != nil || !p.waiting() {
+		t.Errorf("expected nothing, got %v", got)
+	}
+	if got := p.parse(nil, true); !reflect.DeepEqual(got, []Event{KeyEvent{Rune: ']', Mods: ModAlt}}) || p.waiting() {
+		t.Errorf("expected Alt+], got %v", got)
+	}
+	// Pasted text without an end is delivered when the parser is flushed,
+	// and does not swallow the key presses after it
+	if got := p.parse([]byte("\033[200~abc"), false); got != nil || !p.waiting() {
+		t.Errorf("expected nothing, got %v", got)
+	}
+	if got := p.parse(nil, true); !reflect.DeepEqual(got, []Event{PasteEvent{"abc"}}) || p.waiting() {
+		t.Errorf("expected the pasted text, got %v", got)
+	}
+	if got := p.parse([]byte("x"), false); !reflect.DeepEqual(got, []Event{KeyEvent{Rune: 'x'}}) {
+		t.Errorf("expected x, got %v", got)
+	}
+}
@@ -0,0 +1,156 @@
+package vt100
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// colorID is an index into the table of interned AttributeColor values.
+// 0 is the empty AttributeColor (None).
+type colorID uint32
+
+// notInterned marks a background color ID that has not been looked up yet
+const notInterned = ^colorID(0)
+
+// colorTable holds every AttributeColor that has been used in a canvas cell.
+// Colors and states are only ever appended, never modified, so those slices can
+// be read without holding the lock, up to the length they had when they were fetched.
+var colorTable = struct {
+	mut         *sync.RWMutex
+	ids         map[string]colorID
+	colors      []AttributeColor // the interned colors
+	states      []sgrState       // the colors parsed as SGR states
+	backgrounds []colorID        // the IDs of color.Background()
+}{
+	mut:         &sync.RWMutex{},
+	ids:         map[string]colorID{"": 0},
+	colors:      []AttributeColor{None},
+	states:      []sgrState{{}},
+	backgrounds: []colorID{0},
+}
+
+var (
+	defaultID           = internColor(Default)
+	defaultBackgroundID = internColor(DefaultBackground)
+)
+
+// internColor returns the ID of the given AttributeColor, adding it to the table if needed
+func internColor(ac AttributeColor) colorID {
+	colorTable.mut.RLock()
+	id, ok := colorTable.ids[string(ac)]
+	colorTable.mut.RUnlock()
+	if ok {
+		return id
+	}
+	colorTable.mut.Lock()
+	defer colorTable.mut.Unlock()
+	if id, ok := colorTable.ids[string(ac)]; ok {
+		return id
+	}
+	stored := make(AttributeColor, len(ac))
+	copy(stored, ac)
+	var state sgrState
+	state.apply(stored)
+	id = colorID(len(colorTable.colors))
+	colorTable.ids[string(stored)] = id
+	colorTable.colors = append(colorTable.colors, stored)
+	colorTable.states = append(colorTable.states, state)
+	colorTable.backgrounds = append(colorTable.backgrounds, notInterned)
+	return id
+}
+
+// internBackground returns the ID of ac.Background(). The conversion is only done once per color.
+func internBackground(ac AttributeColor) colorID {
+	id := internColor(ac)
+	colorTable.mut.RLock()
+	bgID := colorTable.backgrounds[id]
+	colorTable.mut.RUnlock()
+	if bgID != notInterned {
+		return bgID
+	}
+	bgID = internColor(ac.Background())
+	colorTable.mut.Lock()
+	colorTable.backgrounds[id] = bgID
+	colorTable.mut.Unlock()
+	return bgID
+}
+
+// colorOf returns the AttributeColor for the given ID
+func colorOf(id colorID) AttributeColor {
+	colorTable.mut.RLock()
+	defer colorTable.mut.RUnlock()
+	return colorTable.colors[id]
+}
+
+// colorSnapshot returns the interned colors and their SGR states,
+// for looking up many IDs without locking
+func colorSnapshot() ([]AttributeColor, []sgrState) {
+	colorTable.mut.RLock()
+	defer colorTable.mut.RUnlock()
+	return colorTable.colors, colorTable.states
+}
+
+// textID is an index into the cell texts of a canvas.
+// 0 means that the cell text is just the rune of the cell.
+type textID uint32
+
+// linkID is an index into the hyperlink URLs of a canvas.
+// 0 means that the cell is not a part of a hyperlink.
+type linkID uint32
+
+// stringTable holds the texts of the cells of a canvas that have more than one rune,
+// like a letter followed by combining marks, or the URLs of the hyperlinks, so that
+// a cell only needs to hold an ID. The empty string has ID 0. A table belongs to a
+// canvas and its views, and is protected by the mutex of the canvas.
+type stringTable struct {
+	ids     map[string]uint32
+	strings []string
+}
+
+// newStringTable creates a new stringTable that only has the empty string
+func newStringTable() *stringTable {
+	return &stringTable{ids: map[string]uint32{"": 0}, strings: []string{""}}
+}
+
+// intern returns the ID of the given string, adding it to the table if needed
+func (st *stringTable) intern(s string) uint32 {
+	if id, ok := st.ids[s]; ok {
+		return id
+	}
+	id := uint32(len(st.strings))
+	st.ids[s] = id
+	st.strings = append(st.strings, s)
+	return id
+}
+
+// clone returns a copy of the table
+func (st *stringTable) clone() *stringTable {
+	return &stringTable{ids: maps.Clone(st.ids), strings: slices.Clone(st.strings)}
+}
+
+// compactStrings removes the cell texts and URLs that are not used by any cell, neither
+// in the canvas nor on the screen, and gives the ones that are left new IDs. It is only
+// done if the tables have more strings than there are cells, since the strings that are
+// in use can not be more than that. The canvas mutex must be held, and the canvas must
+// not be a view.
+func (c *Canvas) compactStrings() {
+	limit := len(c.chars) + len(c.oldchars) + 1
+	if len(c.texts.strings) <= limit && len(c.links.strings) <= limit {
+		return
+	}
+	texts, links := newStringTable(), newStringTable()
+	for _, cells := range [][]ColorRune{c.chars, c.oldchars} {
+		for i := range cells {
+			cr := &cells[i]
+			if cr.text != 0 {
+				cr.text = textID(texts.intern(c.texts.strings[cr.text]))
+			}
+			if cr.link != 0 {
+				cr.link = linkID(links.intern(c.links.strings[cr.link]))
+			}
+		}
+	}
+	// The views share the tables, so they are replaced in place
+	*c.texts, *c.links = *texts, *links
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal returns true if the given file descriptor is a terminal
+func isTerminal(fd uintptr) bool {
+	ws := &winsize{}
+	retCode, _, _ := syscall.Syscall(syscall.SYS_IOCTL,
+		fd,
+		uintptr(syscall.TIOCGWINSZ),
+		uintptr(unsafe.Pointer(ws)))
+	return int(retCode) != -1
+}
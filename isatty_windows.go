@@ -0,0 +1,9 @@
+package vt100
+
+import "syscall"
+
+// isTerminal returns true if the given file handle is a console
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
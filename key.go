@@ -4,10 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"time"
 	"unicode"
-	"unicode/utf8"
 
 	"github.com/pkg/term"
 )
@@ -17,55 +17,36 @@ var (
 	lastKey        int
 )
 
-// Key codes for 3-byte sequences (arrows, Home, End)
-var keyCodeLookup = map[[3]byte]int{
-	{27, 91, 65}:  253, // Up Arrow
-	{27, 91, 66}:  255, // Down Arrow
-	{27, 91, 67}:  254, // Right Arrow
-	{27, 91, 68}:  252, // Left Arrow
-	{27, 91, 'H'}: 1,   // Home (Ctrl-A)
-	{27, 91, 'F'}: 5,   // End (Ctrl-E)
+// keySymbols are the symbols that TTY.String and TTY.Rune return for some of the keys
+var keySymbols = map[Key]string{
+	KeyUp:       "↑",
+	KeyDown:     "↓",
+	KeyRight:    "→",
+	KeyLeft:     "←",
+	KeyHome:     "⇱",
+	KeyEnd:      "⇲",
+	KeyPageUp:   "⇞",
+	KeyPageDown: "⇟",
 }
 
-// Key codes for 4-byte sequences (Page Up, Page Down, Home, End)
-var pageNavLookup = map[[4]byte]int{
-	{27, 91, 49, 126}: 1,   // Home (ESC [1~)
-	{27, 91, 52, 126}: 5,   // End (ESC [4~)
-	{27, 91, 53, 126}: 251, // Page Up (custom code)
-	{27, 91, 54, 126}: 250, // Page Down (custom code)
-}
-
-// Key codes for 6-byte sequences (Ctrl-Insert)
-var ctrlInsertLookup = map[[6]byte]int{
-	{27, 91, 50, 59, 53, 126}: 258, // Ctrl-Insert (ESC [2;5~)
-}
-
-// String representations for 3-byte sequences
-var keyStringLookup = map[[3]byte]string{
-	{27, 91, 65}:  "↑", // Up Arrow
-	{27, 91, 66}:  "↓", // Down Arrow
-	{27, 91, 67}:  "→", // Right Arrow
-	{27, 91, 68}:  "←", // Left Arrow
-	{27, 91, 'H'}: "⇱", // Home
-	{27, 91, 'F'}: "⇲", // End
-}
-
-// String representations for 4-byte sequences
-var pageStringLookup = map[[4]byte]string{
-	{27, 91, 49, 126}: "⇱", // Home
-	{27, 91, 52, 126}: "⇲", // End
-	{27, 91, 53, 126}: "⇞", // Page Up
-	{27, 91, 54, 126}: "⇟", // Page Down
-}
-
-// String representations for 6-byte sequences (Ctrl-Insert)
-var ctrlInsertStringLookup = map[[6]byte]string{
-	{27, 91, 50, 59, 53, 126}: "⎘", // Ctrl-Insert (Copy)
+// keySymbol returns the symbol for the arrow keys, Home, End, Page Up, Page Down
+// and Ctrl-Insert (Copy)
+func keySymbol(e KeyEvent) (string, bool) {
+	if e.Key == KeyInsert && e.Mods == ModCtrl {
+		return "⎘", true
+	}
+	if e.Mods != 0 {
+		return "", false
+	}
+	s, ok := keySymbols[e.Key]
+	return s, ok
 }
 
 type TTY struct {
 	t       *term.Term
 	timeout time.Duration
+	input   inputParser // the input that has been read, but not decoded yet
+	events  []Event     // the events that have been decoded, but not returned yet
 }
 
 // NewTTY opens /dev/tty in raw and cbreak mode as a term.Term
@@ -74,7 +55,7 @@ func NewTTY() (*TTY, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &TTY{t, defaultTimeout}, nil
+	return &TTY{t: t, timeout: defaultTimeout}, nil
 }
 
 // SetTimeout sets a timeout for reading a key
@@ -89,82 +70,89 @@ func (tty *TTY) Close() {
 	tty.t.Close()
 }
 
-// asciiAndKeyCode processes input into an ASCII code or key code, handling multi-byte sequences like Ctrl-Insert
-func asciiAndKeyCode(tty *TTY) (ascii, keyCode int, err error) {
-	bytes := make([]byte, 6) // Use 6 bytes to cover longer sequences like Ctrl-Insert
-	var numRead int
-
-	// Set the terminal into raw mode and non-blocking mode with a timeout
-	tty.RawMode()
-	tty.NoBlock()
-	tty.SetTimeout(tty.timeout)
-	// Read bytes from the terminal
-	numRead, err = tty.t.Read(bytes)
-
-	if err != nil {
-		// Restore the terminal settings
-		tty.Restore()
-		// Clear the key buffer
-		tty.t.Flush()
-		return
+// readEvent returns the next key press, mouse event or pasted text. If there are no events
+// that have been read already, the TTY is read from, with the current timeout.
+// Returns nil if nothing was read within the timeout.
+func (tty *TTY) readEvent() (Event, error) {
+	if len(tty.events) == 0 {
+		if err := tty.read(); err != nil {
+			return nil, err
+		}
+		if len(tty.events) == 0 {
+			return nil, nil
+		}
 	}
+	e := tty.events[0]
+	tty.events = tty.events[1:]
+	return e, nil
+}
 
-	// Handle multi-byte sequences
-	switch {
-	case numRead == 1:
-		ascii = int(bytes[0])
-	case numRead == 3:
-		seq := [3]byte{bytes[0], bytes[1], bytes[2]}
-		if code, found := keyCodeLookup[seq]; found {
-			keyCode = code
-			// Restore the terminal settings
-			tty.Restore()
-			// Clear the key buffer
-			tty.t.Flush()
-			return
-		}
-		// Not found, check if it's a printable character
-		r, _ := utf8.DecodeRune(bytes[:numRead])
-		if unicode.IsPrint(r) {
-			ascii = int(r)
+// read reads from the TTY and decodes the input. If the input ends with an escape sequence
+// that is not complete, it waits for the rest of it, for up to escapeTimeout at a time.
+func (tty *TTY) read() error {
+	buf := make([]byte, 4096)
+	n, err := tty.t.Read(buf)
+	for {
+		if err != nil && err != io.EOF {
+			// io.EOF means that the read timed out
+			return err
 		}
-	case numRead == 4:
-		seq := [4]byte{bytes[0], bytes[1], bytes[2], bytes[3]}
-		if code, found := pageNavLookup[seq]; found {
-			keyCode = code
-			// Restore the terminal settings
-			tty.Restore()
-			// Clear the key buffer
-			tty.t.Flush()
-			return
+		tty.events = append(tty.events, tty.input.parse(buf[:n], n == 0)...)
+		if n == 0 || !tty.input.waiting() {
+			return nil
 		}
-	case numRead == 6:
-		seq := [6]byte{bytes[0], bytes[1], bytes[2], bytes[3], bytes[4], bytes[5]}
-		if code, found := ctrlInsertLookup[seq]; found {
-			keyCode = code
-			// Restore the terminal settings
-			tty.Restore()
-			// Clear the key buffer
-			tty.t.Flush()
-			return
+		tty.t.SetReadTimeout(escapeTimeout)
+		n, err = tty.t.Read(buf)
+		tty.t.SetReadTimeout(tty.timeout)
+	}
+}
+
+// readKeyEvent returns the next key press, skipping mouse events and pasted text.
+// Returns false if no key was pressed within the timeout.
+func (tty *TTY) readKeyEvent() (KeyEvent, bool, error) {
+	for {
+		e, err := tty.readEvent()
+		if err != nil || e == nil {
+			return KeyEvent{}, false, err
 		}
-	default:
-		// Attempt to decode as UTF-8
-		r, _ := utf8.DecodeRune(bytes[:numRead])
-		if unicode.IsPrint(r) {
-			ascii = int(r)
+		if ke, ok := e.(KeyEvent); ok {
+			return ke, true, nil
 		}
 	}
+}
 
+// asciiAndKeyCode reads a key press and returns it as either an ASCII code or a key code.
+// Key presses that arrive together, like when typing fast, are returned one at a time.
+func asciiAndKeyCode(tty *TTY) (ascii, keyCode int, err error) {
+	// Set the terminal into raw mode and non-blocking mode with a timeout
+	tty.RawMode()
+	tty.NoBlock()
+	tty.SetTimeout(tty.timeout)
+	e, ok, err := tty.readKeyEvent()
 	// Restore the terminal settings
 	tty.Restore()
-	// Clear the key buffer
-	tty.t.Flush()
-	return
+	if err != nil || !ok {
+		return 0, 0, err
+	}
+	switch e.Key {
+	case KeyRune, KeyTab, KeyEnter, KeyEscape, KeyBackspace:
+		ascii = e.Code()
+	default:
+		keyCode = e.Code()
+	}
+	return ascii, keyCode, nil
 }
 
 // Key reads the keycode or ASCII code and avoids repeated keys
 func (tty *TTY) Key() int {
+	if len(tty.events) > 0 {
+		// A key that was read together with the same key is returned by the next call,
+		// instead of being skipped as a repeat
+		if e, ok := tty.events[0].(KeyEvent); ok && e.Code() == lastKey && lastKey != 0 {
+			lastKey = 0
+			return 0
+		}
+	}
 	ascii, keyCode, err := asciiAndKeyCode(tty)
 	if err != nil {
 		lastKey = 0
@@ -184,112 +172,54 @@ func (tty *TTY) Key() int {
 	return key
 }
 
-// String reads a string, handling key sequences and printable characters
+// String reads a key press or pasted text. Printable characters and pasted text are returned
+// as they are, the arrow keys, Home, End, Page Up, Page Down and Ctrl-Insert as symbols,
+// like "↑", control characters as "c:" followed by the ASCII code, like "c:13" for Enter,
+// and other keys by name, like "F5" or "Alt+x".
 func (tty *TTY) String() string {
-	bytes := make([]byte, 6)
-	var numRead int
 	// Set the terminal into raw mode with a timeout
 	tty.RawMode()
 	tty.SetTimeout(0)
-	// Read bytes from the terminal
-	numRead, err := tty.t.Read(bytes)
-	defer func() {
-		// Restore the terminal settings
-		tty.Restore()
-		tty.t.Flush()
-	}()
-	if err != nil || numRead == 0 {
-		return ""
-	}
-	switch {
-	case numRead == 1:
-		r := rune(bytes[0])
-		if unicode.IsPrint(r) {
-			return string(r)
-		}
-		return "c:" + strconv.Itoa(int(r))
-	case numRead == 3:
-		seq := [3]byte{bytes[0], bytes[1], bytes[2]}
-		if str, found := keyStringLookup[seq]; found {
-			return str
-		}
-		// Attempt to interpret as UTF-8 string
-		return string(bytes[:numRead])
-	case numRead == 4:
-		seq := [4]byte{bytes[0], bytes[1], bytes[2], bytes[3]}
-		if str, found := pageStringLookup[seq]; found {
-			return str
-		}
-		return string(bytes[:numRead])
-	case numRead == 6:
-		seq := [6]byte{bytes[0], bytes[1], bytes[2], bytes[3], bytes[4], bytes[5]}
-		if str, found := ctrlInsertStringLookup[seq]; found {
-			return str
+	defer tty.Restore()
+	for {
+		e, err := tty.readEvent()
+		if err != nil || e == nil {
+			return ""
 		}
-		fallthrough
-	default:
-		bytesLeftToRead, err := tty.t.Available()
-		if err == nil { // success
-			bytes2 := make([]byte, bytesLeftToRead)
-			numRead2, err := tty.t.Read(bytes2)
-			if err != nil { // error
-				// Just read the first read bytes
-				return string(bytes[:numRead])
+		switch e := e.(type) {
+		case PasteEvent:
+			return e.Text
+		case KeyEvent:
+			if s, ok := keySymbol(e); ok {
+				return s
+			}
+			if code := e.Code(); code != 0 && (code < 32 || code == 127) {
+				return "c:" + strconv.Itoa(code)
 			}
-			return string(append(bytes[:numRead], bytes2[:numRead2]...))
+			if e.Key == KeyRune && e.Mods&^ModShift == 0 && unicode.IsPrint(e.Rune) {
+				return string(e.Rune)
+			}
+			return e.String()
 		}
 	}
-	return string(bytes[:numRead])
 }
 
-// Rune reads a rune, handling special sequences for arrows, Home, End, etc.
+// Rune reads a key press and returns the typed character, the ASCII code of a control
+// character, or a symbol for the arrow keys, Home, End, Page Up, Page Down and Ctrl-Insert
 func (tty *TTY) Rune() rune {
-	bytes := make([]byte, 6)
-	var numRead int
-
 	// Set the terminal into raw mode with a timeout
 	tty.RawMode()
 	tty.SetTimeout(0)
-	// Read bytes from the terminal
-	numRead, err := tty.t.Read(bytes)
+	e, ok, err := tty.readKeyEvent()
 	// Restore the terminal settings
 	tty.Restore()
-	tty.t.Flush()
-
-	if err != nil || numRead == 0 {
+	if err != nil || !ok {
 		return rune(0)
 	}
-
-	switch {
-	case numRead == 1:
-		return rune(bytes[0])
-	case numRead == 3:
-		seq := [3]byte{bytes[0], bytes[1], bytes[2]}
-		if str, found := keyStringLookup[seq]; found {
-			return []rune(str)[0]
-		}
-		// Attempt to interpret as UTF-8 rune
-		r, _ := utf8.DecodeRune(bytes[:numRead])
-		return r
-	case numRead == 4:
-		seq := [4]byte{bytes[0], bytes[1], bytes[2], bytes[3]}
-		if str, found := pageStringLookup[seq]; found {
-			return []rune(str)[0]
-		}
-		r, _ := utf8.DecodeRune(bytes[:numRead])
-		return r
-	case numRead == 6:
-		seq := [6]byte{bytes[0], bytes[1], bytes[2], bytes[3], bytes[4], bytes[5]}
-		if str, found := ctrlInsertStringLookup[seq]; found {
-			return []rune(str)[0]
-		}
-		r, _ := utf8.DecodeRune(bytes[:numRead])
-		return r
-	default:
-		// Attempt to interpret as UTF-8 rune
-		r, _ := utf8.DecodeRune(bytes[:numRead])
-		return r
+	if s, ok := keySymbol(e); ok {
+		return []rune(s)[0]
 	}
+	return rune(e.Code())
 }
 
 // RawMode switches the terminal to raw mode
@@ -402,12 +332,15 @@ func KeyCodeOnce() int {
 	return keyCode
 }
 
-// WaitForKey waits for Return, Esc, Space, or 'q' to be pressed
+// WaitForKey waits for Return, Esc, Space, or 'q' to be pressed.
+// If /dev/tty can not be opened, stdin is read instead, until one of those
+// bytes or the end of the input is read.
 func WaitForKey() {
 	// Get a new TTY and start reading keypresses in a loop
 	r, err := NewTTY()
 	if err != nil {
-		panic(err)
+		waitForKeyStdin()
+		return
 	}
 	defer r.Close()
 	for {
@@ -417,3 +350,17 @@ func WaitForKey() {
 		}
 	}
 }
+
+// waitForKeyStdin reads from stdin until Return, Esc, Space or 'q' is read, or until there is no more input
+func waitForKeyStdin() {
+	b := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(b); err != nil {
+			return
+		}
+		switch b[0] {
+		case 10, 13, 27, 32, 113:
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import "testing"
+
+func TestTTYInput(t *testing.T) {
+	tty, ptm := newTestTTY(t)
+	// Key presses that arrive together are returned one at a time, in order
+	ptm.WriteString("ab\033[15;2~\033[A\t\033]11;rgb:0/0/0\033\\x")
+	for _, want := range []string{"a", "b", "Shift+F5", "↑", "c:9", "x"} {
+		if got := tty.String(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	ptm.WriteString("\033[6~\033[2;5~\033[D")
+	for _, want := range []rune{'⇟', '⎘', '←'} {
+		if got := tty.Rune(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	// A repeated key is only skipped once, and not lost
+	ptm.WriteString("zz\033[B")
+	tty.SetTimeout(defaultTimeout)
+	for _, want := range []int{'z', 0, 'z', 255} {
+		if got := tty.Key(); got != want {
+			t.Errorf("got %d, want %d", got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package vt100
+
+import "strings"
+
+// Key is a key on the keyboard, like an arrow key or a function key.
+// Keys that type a character are KeyRune, and the character is in KeyEvent.Rune.
+type Key int
+
+const (
+	KeyRune Key = iota // a key that types a character
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyInsert
+	KeyDelete
+	KeyTab
+	KeyBackTab // Shift-Tab
+	KeyEnter
+	KeyEscape
+	KeyBackspace
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyF13
+	KeyF14
+	KeyF15
+	KeyF16
+	KeyF17
+	KeyF18
+	KeyF19
+	KeyF20
+	KeyF21
+	KeyF22
+	KeyF23
+	KeyF24
+)
+
+// keyNames are the names of the keys, for KeyEvent.String
+var keyNames = map[Key]string{
+	KeyUp:        "Up",
+	KeyDown:      "Down",
+	KeyLeft:      "Left",
+	KeyRight:     "Right",
+	KeyHome:      "Home",
+	KeyEnd:       "End",
+	KeyPageUp:    "PgUp",
+	KeyPageDown:  "PgDn",
+	KeyInsert:    "Insert",
+	KeyDelete:    "Delete",
+	KeyTab:       "Tab",
+	KeyBackTab:   "BackTab",
+	KeyEnter:     "Enter",
+	KeyEscape:    "Esc",
+	KeyBackspace: "Backspace",
+	KeyF1:        "F1",
+	KeyF2:        "F2",
+	KeyF3:        "F3",
+	KeyF4:        "F4",
+	KeyF5:        "F5",
+	KeyF6:        "F6",
+	KeyF7:        "F7",
+	KeyF8:        "F8",
+	KeyF9:        "F9",
+	KeyF10:       "F10",
+	KeyF11:       "F11",
+	KeyF12:       "F12",
+	KeyF13:       "F13",
+	KeyF14:       "F14",
+	KeyF15:       "F15",
+	KeyF16:       "F16",
+	KeyF17:       "F17",
+	KeyF18:       "F18",
+	KeyF19:       "F19",
+	KeyF20:       "F20",
+	KeyF21:       "F21",
+	KeyF22:       "F22",
+	KeyF23:       "F23",
+	KeyF24:       "F24",
+}
+
+// Mods are the modifier keys that were held down while a key was pressed
+type Mods uint8
+
+const (
+	ModShift Mods = 1 << iota
+	ModAlt
+	ModCtrl
+	ModMeta
+)
+
+// modsFromParam returns the modifiers of an xterm style modifier parameter, like the 5
+// in ESC [ 1 ; 5 A (Ctrl-Up), which is 1 + the sum of 1 for Shift, 2 for Alt, 4 for Ctrl
+// and 8 for Meta
+func modsFromParam(n int) Mods {
+	if n < 1 {
+		return 0
+	}
+	return Mods(n-1) & (ModShift | ModAlt | ModCtrl | ModMeta)
+}
+
+// KeyEvent is a key press, together with the modifier keys that were held down.
+// Ctrl together with a letter is reported as the lower case letter with ModCtrl,
+// and Alt together with a key is reported as the key with ModAlt.
+// Shift together with a character is usually just reported as the character.
+type KeyEvent struct {
+	Key  Key
+	Rune rune // the character, if Key is KeyRune
+	Mods Mods
+}
+
+// keyEventFromByte returns the key event for a typed ASCII character or control character
+func keyEventFromByte(b byte) KeyEvent {
+	switch {
+	case b == 9:
+		return KeyEvent{Key: KeyTab}
+	case b == 13:
+		return KeyEvent{Key: KeyEnter}
+	case b == 27:
+		return KeyEvent{Key: KeyEscape}
+	case b == 127:
+		return KeyEvent{Key: KeyBackspace}
+	case b == 0:
+		return KeyEvent{Rune: ' ', Mods: ModCtrl}
+	case b < 27:
+		return KeyEvent{Rune: rune('a' + b - 1), Mods: ModCtrl}
+	case b < 32:
+		// Ctrl-\, Ctrl-], Ctrl-^ and Ctrl-_
+		return KeyEvent{Rune: rune(b + 64), Mods: ModCtrl}
+	}
+	return KeyEvent{Rune: rune(b)}
+}
+
+// String returns the name of the key, together with the modifiers, like "Ctrl+Alt+Up",
+// "Ctrl+c", "F5" or "é"
+func (e KeyEvent) String() string {
+	var sb strings.Builder
+	for _, mod := range []struct {
+		mod  Mods
+		name string
+	}{
+		{ModCtrl, "Ctrl+"},
+		{ModAlt, "Alt+"},
+		{ModShift, "Shift+"},
+		{ModMeta, "Meta+"},
+	} {
+		if e.Mods&mod.mod != 0 {
+			sb.WriteString(mod.name)
+		}
+	}
+	switch {
+	case e.Key != KeyRune:
+		sb.WriteString(keyNames[e.Key])
+	case e.Rune == ' ':
+		sb.WriteString("Space")
+	default:
+		sb.WriteRune(e.Rune)
+	}
+	return sb.String()
+}
+
+// Code returns the key code that TTY.Key returns for this key press: the ASCII code or
+// Unicode code point of a character or control character, or one of the key codes for
+// the arrow keys (252 to 255), Page Up (251), Page Down (250), Home (1), End (5) and
+// Ctrl-Insert (258). Returns 0 for keys that do not have a key code, like the function keys.
+func (e KeyEvent) Code() int {
+	switch e.Key {
+	case KeyRune:
+		if e.Mods&ModCtrl != 0 {
+			switch r := e.Rune; {
+			case r == ' ':
+				return 0
+			case 'a' <= r && r <= 'z':
+				return int(r-'a') + 1
+			case r == '\\' || r == ']' || r == '^' || r == '_':
+				return int(r) - 64
+			}
+		}
+		return int(e.Rune)
+	case KeyUp:
+		return 253
+	case KeyDown:
+		return 255
+	case KeyRight:
+		return 254
+	case KeyLeft:
+		return 252
+	case KeyPageUp:
+		return 251
+	case KeyPageDown:
+		return 250
+	case KeyHome:
+		return 1
+	case KeyEnd:
+		return 5
+	case KeyInsert:
+		if e.Mods == ModCtrl {
+			return 258
+		}
+	case KeyTab:
+		return 9
+	case KeyEnter:
+		return 13
+	case KeyEscape:
+		return 27
+	case KeyBackspace:
+		return 127
+	}
+	return 0
+}
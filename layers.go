@@ -0,0 +1,205 @@
+package vt100
+
+import (
+	"sort"
+	"sync"
+)
+
+// Layer is a canvas that is part of a layer stack. It has a position on the
+// screen, a z-order and can be shown or hidden.
+// Cells with no rune and no background color (like cells that are written
+// with None as the background color and then cleared) are transparent.
+// Cells with a rune but no background color use the background color of
+// whatever is below them.
+type Layer struct {
+	*Canvas
+	stack   *Layers
+	x, y    int
+	z       int
+	visible bool
+}
+
+// Layers is a stack of layers that are combined into one screen canvas before it is drawn.
+// The layer with the lowest z-order is at the bottom. Layers with the same z-order
+// are stacked in the order they were added.
+type Layers struct {
+	mut    *sync.RWMutex
+	screen *Canvas
+	layers []*Layer
+}
+
+// NewLayers creates a new layer stack that is flattened into the given screen canvas
+func NewLayers(screen *Canvas) *Layers {
+	return &Layers{mut: &sync.RWMutex{}, screen: screen}
+}
+
+// Screen returns the canvas that the layers are flattened into
+func (ls *Layers) Screen() *Canvas {
+	return ls.screen
+}
+
+// NewLayer creates a new visible layer of the given size at position 0,0 and with
+// the given z-order, and adds it to the stack. All cells of the new layer are transparent.
+func (ls *Layers) NewLayer(w, h uint, z int) *Layer {
+	l := &Layer{Canvas: NewOffscreenCanvas(w, h), stack: ls, z: z, visible: true}
+	l.Clear()
+	ls.mut.Lock()
+	ls.layers = append(ls.layers, l)
+	ls.mut.Unlock()
+	return l
+}
+
+// NewScreenLayer creates a new visible layer with the same size as the screen canvas.
+// See NewLayer.
+func (ls *Layers) NewScreenLayer(z int) *Layer {
+	w, h := ls.screen.Size()
+	return ls.NewLayer(w, h, z)
+}
+
+// Remove removes the given layer from the stack
+func (ls *Layers) Remove(l *Layer) {
+	ls.mut.Lock()
+	defer ls.mut.Unlock()
+	for i, other := range ls.layers {
+		if other == l {
+			ls.layers = append(ls.layers[:i], ls.layers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Flatten combines all visible layers into the screen canvas, from the bottom and up.
+// Everything that was on the screen canvas is replaced.
+func (ls *Layers) Flatten() {
+	ls.mut.RLock()
+	layers := make([]*Layer, 0, len(ls.layers))
+	for _, l := range ls.layers {
+		if l.visible {
+			layers = append(layers, l)
+		}
+	}
+	positions := make([][2]int, len(layers))
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].z < layers[j].z
+	})
+	for i, l := range layers {
+		positions[i] = [2]int{l.x, l.y}
+	}
+	ls.mut.RUnlock()
+
+	screen := ls.screen
+	screen.mut.Lock()
+	defer screen.mut.Unlock()
+	for y := uint(0); y < screen.h; y++ {
+		row := screen.row(y)
+		for i := range row {
+			row[i] = ColorRune{fg: defaultID, bg: defaultBackgroundID}
+		}
+	}
+	for i, l := range layers {
+		l.mut.RLock()
+		screen.composite(l.Canvas, positions[i][0], positions[i][1])
+		l.mut.RUnlock()
+	}
+}
+
+// Draw flattens the layers into the screen canvas and then draws it
+func (ls *Layers) Draw() {
+	ls.Flatten()
+	ls.screen.Draw()
+}
+
+// composite places the cells of src on top of this canvas, with the upper left
+// corner of src at x,y. Transparent cells are skipped and cells without a
+// background color get the background color of the cell below.
+// Both canvas mutexes must be held.
+func (c *Canvas) composite(src *Canvas, x, y int) {
+	for sy := 0; sy < int(src.h); sy++ {
+		dy := y + sy
+		if dy < 0 || dy >= int(c.h) {
+			continue
+		}
+		row := src.row(uint(sy))
+		for sx := range row {
+			dx := x + sx
+			if dx < 0 || dx >= int(c.w) {
+				continue
+			}
+			cr := row[sx]
+			if (cr.r == 0 && cr.bg == 0) || cr.r == wideContinuation {
+				// Transparent, or covered by the wide cell to the left
+				continue
+			}
+			i := c.index(uint(dx), uint(dy))
+			if cr.bg == 0 {
+				cr.bg = c.chars[i].bg
+			}
+			c.put(i, cr)
+		}
+	}
+}
+
+// Clear makes all cells of the layer transparent
+func (l *Layer) Clear() {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for y := uint(0); y < l.h; y++ {
+		row := l.row(y)
+		for i := range row {
+			row[i] = ColorRune{}
+		}
+	}
+}
+
+// Move places the upper left corner of the layer at x,y on the screen.
+// The layer may be partially outside of the screen.
+func (l *Layer) Move(x, y int) {
+	l.stack.mut.Lock()
+	l.x, l.y = x, y
+	l.stack.mut.Unlock()
+}
+
+// Position returns the position of the upper left corner of the layer
+func (l *Layer) Position() (int, int) {
+	l.stack.mut.RLock()
+	defer l.stack.mut.RUnlock()
+	return l.x, l.y
+}
+
+// SetZ changes the z-order of the layer. Layers with a higher z-order are placed on top.
+func (l *Layer) SetZ(z int) {
+	l.stack.mut.Lock()
+	l.z = z
+	l.stack.mut.Unlock()
+}
+
+// Z returns the z-order of the layer
+func (l *Layer) Z() int {
+	l.stack.mut.RLock()
+	defer l.stack.mut.RUnlock()
+	return l.z
+}
+
+// SetVisible shows or hides the layer
+func (l *Layer) SetVisible(visible bool) {
+	l.stack.mut.Lock()
+	l.visible = visible
+	l.stack.mut.Unlock()
+}
+
+// Visible returns true if the layer is shown
+func (l *Layer) Visible() bool {
+	l.stack.mut.RLock()
+	defer l.stack.mut.RUnlock()
+	return l.visible
+}
+
+// Show shows the layer
+func (l *Layer) Show() {
+	l.SetVisible(true)
+}
+
+// Hide hides the layer
+func (l *Layer) Hide() {
+	l.SetVisible(false)
+}
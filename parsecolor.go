@@ -0,0 +1,266 @@
+package vt100
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// colorModifiers are the attribute names that can be given to ParseColor
+var colorModifiers = map[string]AttributeColor{
+	"bold":             {1},
+	"bright":           {1},
+	"dim":              {2},
+	"faint":            {2},
+	"italic":           {3},
+	"underline":        {4},
+	"underlined":       {4},
+	"underscore":       {4},
+	"blink":            {5},
+	"reverse":          {7},
+	"inverse":          {7},
+	"hidden":           {8},
+	"strikethrough":    {9},
+	"strike":           {9},
+	"overline":         {53},
+	"double-underline": styledUnderline(2),
+	"curly-underline":  styledUnderline(3),
+	"undercurl":        styledUnderline(3),
+	"dotted-underline": styledUnderline(4),
+	"dashed-underline": styledUnderline(5),
+}
+
+// ParseColor parses a color description, like the ones found in configuration files
+// and command line flags. It consists of attributes, a foreground color and "on"
+// followed by a background color, where every part is optional, like "bold red on blue",
+// "#ff8800", "underline rgb(255, 136, 0)" or "on 256:17". The colors can be given as:
+//
+//   - the basic color names in DarkColorMap, like "red" or "lightblue"
+//   - the CSS (X11) color names, like "orange" or "cornflowerblue"
+//   - "#rgb" or "#rrggbb"
+//   - "rgb(r, g, b)", with values from 0 to 255, or percentages
+//   - "hsl(h, s%, l%)", with the hue in degrees
+//   - "ansi:n", for the basic colors 0 to 15
+//   - "256:n", for the colors 0 to 255 in the xterm 256 color palette
+//   - "default", for the default color
+//
+// The attributes are bold (or bright), dim, italic, underline, double-underline,
+// curly-underline (or undercurl), dotted-underline, dashed-underline, blink, reverse,
+// hidden, strikethrough and overline. Names are not case sensitive.
+func ParseColor(s string) (AttributeColor, error) {
+	words := colorWords(s)
+	if len(words) == 0 {
+		return nil, errors.New("no color given")
+	}
+	var attributes, fg, bg AttributeColor
+	background := false
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if word == "on" {
+			if background {
+				return nil, fmt.Errorf("more than one \"on\" in color: %q", s)
+			}
+			background = true
+			continue
+		}
+		if code, ok := colorModifiers[word]; ok && !background {
+			attributes = append(attributes, code...)
+			continue
+		}
+		c, err := parseColorWord(word)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case background && bg != nil:
+			return nil, fmt.Errorf("more than one background color in: %q", s)
+		case background:
+			bg = c.Background()
+		case fg != nil:
+			return nil, fmt.Errorf("more than one foreground color in: %q", s)
+		default:
+			fg = c
+		}
+	}
+	if background && bg == nil {
+		return nil, fmt.Errorf("no background color after \"on\" in: %q", s)
+	}
+	result := make(AttributeColor, 0, len(attributes)+len(fg)+len(bg))
+	return append(append(append(result, attributes...), fg...), bg...), nil
+}
+
+// MustParseColor is like ParseColor, but panics if the color can not be parsed
+func MustParseColor(s string) AttributeColor {
+	ac, err := ParseColor(s)
+	if err != nil {
+		panic(err)
+	}
+	return ac
+}
+
+// colorWords splits a color description into words, keeping the arguments
+// of rgb(...) and hsl(...) together
+func colorWords(s string) []string {
+	var words []string
+	var word strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case (r == ' ' || r == '\t' || r == '\n') && depth == 0:
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// parseColorWord parses a single foreground color, like "red", "#f80" or "256:208"
+func parseColorWord(word string) (AttributeColor, error) {
+	if word == "default" {
+		return Default, nil
+	}
+	if c, ok := DarkColorMap[word]; ok {
+		return c, nil
+	}
+	if rgb, ok := namedColors[word]; ok {
+		return RGB(rgb[0], rgb[1], rgb[2]), nil
+	}
+	switch {
+	case strings.HasPrefix(word, "#"):
+		return parseHexColor(word)
+	case strings.HasPrefix(word, "rgb(") && strings.HasSuffix(word, ")"):
+		return parseRGBFunction(word[4 : len(word)-1])
+	case strings.HasPrefix(word, "hsl(") && strings.HasSuffix(word, ")"):
+		return parseHSLFunction(word[4 : len(word)-1])
+	case strings.HasPrefix(word, "ansi:"):
+		n, err := strconv.Atoi(word[5:])
+		if err != nil || n < 0 || n > 15 {
+			return nil, fmt.Errorf("invalid basic color number, it should be from 0 to 15: %q", word)
+		}
+		if n >= 8 {
+			return AttributeColor{byte(90 + n - 8)}, nil
+		}
+		return AttributeColor{byte(30 + n)}, nil
+	case strings.HasPrefix(word, "256:"):
+		n, err := strconv.Atoi(word[4:])
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("invalid 256 color number, it should be from 0 to 255: %q", word)
+		}
+		return Color256(byte(n)), nil
+	}
+	return nil, fmt.Errorf("unknown color: %q", word)
+}
+
+// parseHexColor parses a color like "#f80" or "#ff8800"
+func parseHexColor(word string) (AttributeColor, error) {
+	digits := word[1:]
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if len(digits) != 6 {
+		return nil, fmt.Errorf("invalid hex color, it should be #rgb or #rrggbb: %q", word)
+	}
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex color: %q", word)
+	}
+	return RGB(byte(n>>16), byte(n>>8), byte(n)), nil
+}
+
+// functionArgs splits the arguments of rgb(...) or hsl(...), which can be separated
+// by commas or spaces
+func functionArgs(args string) []string {
+	return strings.FieldsFunc(args, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// parseRGBFunction parses the arguments of rgb(...), like "255, 136, 0" or "100% 50% 0%"
+func parseRGBFunction(args string) (AttributeColor, error) {
+	parts := functionArgs(args)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("rgb() needs three values: %q", args)
+	}
+	var rgb [3]byte
+	for i, part := range parts {
+		var v float64
+		var err error
+		if strings.HasSuffix(part, "%") {
+			v, err = strconv.ParseFloat(part[:len(part)-1], 64)
+			v = v * 255 / 100
+		} else {
+			v, err = strconv.ParseFloat(part, 64)
+		}
+		if err != nil || v < 0 || v > 255 {
+			return nil, fmt.Errorf("invalid rgb() value: %q", part)
+		}
+		rgb[i] = byte(math.Round(v))
+	}
+	return RGB(rgb[0], rgb[1], rgb[2]), nil
+}
+
+// parseHSLFunction parses the arguments of hsl(...), like "30, 100%, 50%"
+func parseHSLFunction(args string) (AttributeColor, error) {
+	parts := functionArgs(args)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("hsl() needs three values: %q", args)
+	}
+	h, err := strconv.ParseFloat(strings.TrimSuffix(parts[0], "deg"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hsl() hue: %q", parts[0])
+	}
+	var sl [2]float64
+	for i, part := range parts[1:] {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+		if err != nil || v < 0 || v > 100 {
+			return nil, fmt.Errorf("invalid hsl() percentage: %q", part)
+		}
+		sl[i] = v / 100
+	}
+	r, g, b := hslToRGB(h, sl[0], sl[1])
+	return RGB(r, g, b), nil
+}
+
+// hslToRGB converts a color from hue (in degrees), saturation and lightness
+// (from 0 to 1) to red, green and blue
+func hslToRGB(h, s, l float64) (byte, byte, byte) {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	toByte := func(v float64) byte {
+		return byte(math.Round((v + m) * 255))
+	}
+	return toByte(r), toByte(g), toByte(b)
+}
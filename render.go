@@ -0,0 +1,283 @@
+package vt100
+
+import (
+	"strconv"
+	"strings"
+)
+
+// equal checks if two cells look the same when drawn
+func (cr *ColorRune) equal(other *ColorRune) bool {
+	return *cr == *other
+}
+
+// width returns the number of columns that the cell occupies, given the interned cell texts
+func (cr *ColorRune) width(texts []string) int {
+	if cr.text != 0 {
+		return clusterWidth(texts[cr.text])
+	}
+	return RuneWidth(cr.r)
+}
+
+// writeGlyph writes what the cell at position x in the given row looks like:
+// the cell text, or a space for empty cells and for wide cells that have been
+// cut in half. Nothing is written for the right half of a wide cell.
+// Returns the number of columns that were written.
+func writeGlyph(sb *strings.Builder, row []ColorRune, x int, texts []string) int {
+	cr := &row[x]
+	width := cr.width(texts)
+	switch {
+	case cr.r == wideContinuation:
+		if x > 0 && row[x-1].width(texts) == 2 {
+			return 0
+		}
+	case cr.r == 0:
+	case width == 2 && (x+1 >= len(row) || row[x+1].r != wideContinuation):
+	case cr.text != 0:
+		sb.WriteString(texts[cr.text])
+		return width
+	default:
+		sb.WriteRune(cr.r)
+		return width
+	}
+	sb.WriteByte(' ')
+	return 1
+}
+
+// cursorTo writes the terminal codes for moving the cursor to x,y (0,0 is top left).
+// This is the same as the "Cursor Home" command, without the memoization,
+// since there may be one entry per cell.
+func cursorTo(sb *strings.Builder, x, y uint) {
+	sb.WriteString("\033[")
+	sb.WriteString(strconv.FormatUint(uint64(y+1), 10))
+	sb.WriteByte(';')
+	sb.WriteString(strconv.FormatUint(uint64(x+1), 10))
+	sb.WriteByte('H')
+}
+
+// cursorToLen returns the number of bytes needed for moving the cursor to x,y
+func cursorToLen(x, y uint) int {
+	return len(strconv.FormatUint(uint64(y+1), 10)) + len(strconv.FormatUint(uint64(x+1), 10)) + 4
+}
+
+// writeHyperlink writes the OSC 8 terminal code for starting a hyperlink to the given URL,
+// or for ending the current hyperlink if the URL is empty
+func writeHyperlink(sb *strings.Builder, url string) {
+	sb.WriteString("\033]8;;")
+	sb.WriteString(url)
+	sb.WriteString("\033\\")
+}
+
+// frameWriter keeps track of the attributes and colors that have been sent
+// to the terminal, while a frame is being built
+type frameWriter struct {
+	sb     *strings.Builder
+	sgr    sgrWriter
+	colors []AttributeColor // interned colors
+	states []sgrState       // interned colors, as SGR states
+	caps   sgrCaps          // the colors and attributes are converted to what the terminal can show
+	texts  []string         // interned cell texts
+	links  []string         // interned hyperlink URLs
+	link   linkID           // the hyperlink that is open, if any
+	lastfg colorID
+	lastbg colorID
+	last   sgrState
+	parsed bool // has lastfg and lastbg been parsed into last?
+}
+
+// newFrameWriter creates a new frameWriter. The canvas mutex must be held while
+// it is created, so that all colors in the canvas are in the interned color snapshot.
+func (c *Canvas) newFrameWriter(sb *strings.Builder, caps sgrCaps) *frameWriter {
+	colors, states := colorSnapshot()
+	return &frameWriter{sb: sb, colors: colors, states: states, texts: c.texts.strings, links: c.links.strings, caps: caps}
+}
+
+// cells writes the cells from start up to end in the given row, together with
+// the shortest terminal commands for changing attributes and colors between them
+func (fw *frameWriter) cells(row []ColorRune, start, end int) {
+	for x := start; x < end; x++ {
+		cr := &row[x]
+		if cr.r == wideContinuation && x > 0 && row[x-1].width(fw.texts) == 2 {
+			// Already covered by the wide cell to the left
+			continue
+		}
+		if !fw.parsed || fw.lastfg != cr.fg || fw.lastbg != cr.bg {
+			fw.last = fw.states[cr.fg]
+			fw.last.apply(fw.colors[cr.bg])
+			fw.last = fw.last.degrade(fw.caps)
+			fw.lastfg = cr.fg
+			fw.lastbg = cr.bg
+			fw.parsed = true
+		}
+		fw.sgr.transition(fw.sb, fw.last)
+		if cr.link != fw.link {
+			writeHyperlink(fw.sb, fw.links[cr.link])
+			fw.link = cr.link
+		}
+		writeGlyph(fw.sb, row, x, fw.texts)
+	}
+}
+
+// end resets the attributes and colors, if any were set, and ends the open hyperlink
+func (fw *frameWriter) end() {
+	fw.sgr.reset(fw.sb)
+	if fw.link != 0 {
+		writeHyperlink(fw.sb, "")
+		fw.link = 0
+	}
+}
+
+// repaintAll writes every cell of the canvas, one line at a time.
+// The canvas mutex must be held.
+func (c *Canvas) repaintAll(sb *strings.Builder, caps sgrCaps) {
+	fw := c.newFrameWriter(sb, caps)
+	for y := uint(0); y < c.h; y++ {
+		cursorTo(sb, 0, y)
+		fw.cells(c.chars[y*c.w:(y+1)*c.w], 0, int(c.w))
+	}
+	fw.end()
+}
+
+// repaintChanged compares the canvas with the previous frame and writes the
+// cursor movements and runs of cells that are needed to update the screen.
+// Unchanged cells between two changed runs are rewritten if that is cheaper
+// than moving the cursor. Returns false if no cells have changed.
+// The canvas mutex must be held, and c.oldchars must have the same size as c.chars.
+func (c *Canvas) repaintChanged(sb *strings.Builder, caps sgrCaps) bool {
+	fw := c.newFrameWriter(sb, caps)
+	changed := false
+	for y := uint(0); y < c.h; y++ {
+		row := c.chars[y*c.w : (y+1)*c.w]
+		oldrow := c.oldchars[y*c.w : (y+1)*c.w]
+		x := uint(0)
+		for x < c.w {
+			if row[x].equal(&oldrow[x]) {
+				x++
+				continue
+			}
+			start, end := x, x+1
+			for end < c.w {
+				if !row[end].equal(&oldrow[end]) {
+					end++
+					continue
+				}
+				// Find the end of this run of unchanged cells
+				gapEnd := end
+				for gapEnd < c.w && row[gapEnd].equal(&oldrow[gapEnd]) {
+					gapEnd++
+				}
+				if gapEnd == c.w || int(gapEnd-end) >= cursorToLen(gapEnd, y) {
+					break
+				}
+				// Rewriting the unchanged cells is cheaper than moving the cursor past them
+				end = gapEnd
+			}
+			// Include both halves of wide cells at the edges of the run
+			if start > 0 && row[start].r == wideContinuation {
+				start--
+			}
+			if end < c.w && row[end].r == wideContinuation {
+				end++
+			}
+			cursorTo(sb, start, y)
+			fw.cells(row, int(start), int(end))
+			changed = true
+			x = end
+		}
+	}
+	fw.end()
+	return changed
+}
+
+// render builds the terminal output needed for bringing the screen up to date
+// with the canvas, and saves the current state as the previous frame.
+// Only the changed cells are written, unless a full repaint is needed or is shorter.
+// Returns an empty string if nothing has changed.
+func (c *Canvas) render() string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if len(c.chars) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	caps := c.t.sgrCaps()
+	fullRepaint := c.repaint || len(c.oldchars) != len(c.chars)
+	if fullRepaint {
+		c.repaintAll(&sb, caps)
+	} else if !c.repaintChanged(&sb, caps) {
+		return ""
+	}
+	s := sb.String()
+	if !fullRepaint && len(s) > len(c.chars) {
+		// A full repaint writes at least one byte per cell, so it can only be
+		// shorter if the partial update is longer than that
+		var full strings.Builder
+		full.Grow(len(s))
+		c.repaintAll(&full, caps)
+		if full.Len() < len(s) {
+			s = full.String()
+		}
+	}
+	c.repaint = false
+	if len(c.oldchars) != len(c.chars) {
+		c.oldchars = make([]ColorRune, len(c.chars))
+	}
+	copy(c.oldchars, c.chars)
+	return s
+}
+
+// draw updates the changed parts of the screen, or every rune if runewise is enabled.
+// A visible cursor is hidden while drawing.
+func (c *Canvas) draw() {
+	if c.root != nil {
+		c.root.draw()
+		return
+	}
+	if c.offscreen {
+		return
+	}
+	s := c.render()
+	if s == "" {
+		return
+	}
+	if c.runewise {
+		if c.cursorVisible {
+			c.t.ShowCursor(false)
+			defer c.t.ShowCursor(true)
+		}
+		c.t.Clear()
+		c.PlotAll()
+		return
+	}
+	if c.cursorVisible {
+		s = c.t.sequence(cmdHideCursor) + s + c.t.sequence(cmdShowCursor)
+	}
+	// Write everything at once, to avoid flickering
+	c.t.Print(s)
+}
+
+// HideCursorAndDraw will hide the cursor and then draw the canvas
+func (c *Canvas) HideCursorAndDraw() {
+	c.SetShowCursor(false)
+	c.draw()
+}
+
+// Draw the canvas. Only the cells that have changed since the previous Draw are written.
+func (c *Canvas) Draw() {
+	c.draw()
+}
+
+// Redraw the entire canvas, regardless of what has changed
+func (c *Canvas) Redraw() {
+	c.mut.Lock()
+	c.top().repaint = true
+	c.mut.Unlock()
+	c.Draw()
+}
+
+// HideCursorAndRedraw will hide the cursor and then redraw the entire canvas
+func (c *Canvas) HideCursorAndRedraw() {
+	c.mut.Lock()
+	c.top().repaint = true
+	c.mut.Unlock()
+	c.HideCursorAndDraw()
+}
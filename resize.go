@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WatchResize resizes the canvas whenever the terminal is resized (SIGWINCH is received),
+// keeping the contents anchored to the corner set with SetAnchor, and sends the new size
+// on the returned channel. The next Draw repaints the whole screen.
+// If the size has not been received before the next resize, only the latest size is kept.
+// The channel is closed when the given context is done.
+func (c *Canvas) WatchResize(ctx context.Context) <-chan Size {
+	sizes := make(chan Size, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		defer close(sizes)
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				w, h := MustTermSize()
+				if !c.ResizeTo(w, h) {
+					continue
+				}
+				// Replace any size that has not been received yet
+				select {
+				case <-sizes:
+				default:
+				}
+				sizes <- Size{w, h}
+			}
+		}
+	}()
+	return sizes
+}
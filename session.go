@@ -0,0 +1,220 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/term"
+)
+
+// fatalSignals are the signals that terminate the program by default,
+// and that should not leave the terminal in a broken state
+var fatalSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// stopProcess stops the program until it is continued. SIGSTOP can not be caught.
+// The tests replace it, so that they are not stopped.
+var stopProcess = func() {
+	syscall.Kill(syscall.Getpid(), syscall.SIGSTOP)
+}
+
+// Session is a full-screen terminal session. It remembers the terminal settings
+// that were in effect when it was started, and restores them when it is closed,
+// when the program panics (by using Recover) and when the program receives a
+// signal that would terminate it.
+type Session struct {
+	t          *Terminal
+	tty        *term.Term // for restoring the original terminal settings, or nil if there is no TTY
+	signals    chan os.Signal
+	done       chan struct{}
+	once       *sync.Once
+	mut        *sync.Mutex
+	jobControl chan os.Signal // SIGTSTP and SIGCONT, if HandleSuspend has been called
+	canvases   []*Canvas      // canvases to redraw when the program is resumed
+	resumed    bool           // has the program just been resumed by Suspend?
+}
+
+// Start records the current TTY settings, initializes the terminal (see Init) and
+// returns a Session that restores everything when it is closed.
+// Start and Close can be used instead of Init and Close, like this:
+//
+//	s := vt100.Start()
+//	defer s.Close()
+//	defer s.Recover()
+//
+// If the program receives SIGINT, SIGTERM, SIGHUP or SIGQUIT, the terminal is
+// restored before the signal is raised again, so that the program is terminated as usual.
+func Start() *Session {
+	return StartTerminal(stdoutTerminal)
+}
+
+// StartTerminal is like Start, but initializes the given Terminal instead of stdout
+func StartTerminal(t *Terminal) *Session {
+	s := &Session{
+		t:       t,
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+		once:    &sync.Once{},
+		mut:     &sync.Mutex{},
+	}
+	// Opening the TTY records the original settings. It is fine if there is no TTY.
+	if tty, err := term.Open("/dev/tty"); err == nil {
+		s.tty = tty
+	}
+	signal.Notify(s.signals, fatalSignals...)
+	go s.handleSignals()
+	t.Init()
+	return s
+}
+
+// handleSignals restores the terminal and then raises the received signal again
+func (s *Session) handleSignals() {
+	select {
+	case sig := <-s.signals:
+		s.Close()
+		signal.Reset(sig)
+		if sysSig, ok := sig.(syscall.Signal); ok {
+			syscall.Kill(syscall.Getpid(), sysSig)
+		}
+	case <-s.done:
+	}
+}
+
+// Terminal returns the Terminal that this session is using
+func (s *Session) Terminal() *Terminal {
+	return s.t
+}
+
+// restore resets the display attributes, closes the terminal (see Close) and
+// restores the recorded TTY settings
+func (s *Session) restore() {
+	s.t.SetNoColor()
+	s.t.Close()
+	if s.tty != nil {
+		s.tty.Restore()
+	}
+}
+
+// Close restores the terminal to how it was before the session was started.
+// It is safe to call Close more than once.
+func (s *Session) Close() {
+	s.once.Do(func() {
+		signal.Stop(s.signals)
+		s.mut.Lock()
+		if s.jobControl != nil {
+			signal.Stop(s.jobControl)
+		}
+		s.mut.Unlock()
+		close(s.done)
+		s.restore()
+		if s.tty != nil {
+			s.tty.Close()
+		}
+	})
+}
+
+// Recover restores the terminal if the program is panicking, and then panics again,
+// so that the panic message is readable. It must be called directly with defer:
+//
+//	defer s.Recover()
+func (s *Session) Recover() {
+	if r := recover(); r != nil {
+		s.Close()
+		panic(r)
+	}
+}
+
+// HandleSuspend makes the session handle job control. When the program receives
+// SIGTSTP (Ctrl-Z in cooked mode), the terminal is restored and the program is stopped,
+// just like with Suspend. When the program is continued, the given canvases are resized
+// to the current terminal size and redrawn. HandleSuspend can be called more than once,
+// to add more canvases.
+func (s *Session) HandleSuspend(canvases ...*Canvas) {
+	s.mut.Lock()
+	s.canvases = append(s.canvases, canvases...)
+	start := s.jobControl == nil
+	if start {
+		s.jobControl = make(chan os.Signal, 1)
+		signal.Notify(s.jobControl, syscall.SIGTSTP, syscall.SIGCONT)
+	}
+	s.mut.Unlock()
+	if start {
+		go s.handleJobControl()
+	}
+}
+
+// handleJobControl suspends the program on SIGTSTP and redraws the canvases on SIGCONT
+func (s *Session) handleJobControl() {
+	for {
+		select {
+		case sig := <-s.jobControl:
+			if sig == syscall.SIGTSTP {
+				s.Suspend()
+			} else {
+				s.continued()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Suspend restores the terminal to how it was before the session was started,
+// including cooked mode, the normal screen buffer and the cursor, and then stops
+// the program, like Ctrl-Z does in a shell. When the program is continued (with "fg"),
+// the terminal settings are set up again, the canvases that were given to HandleSuspend
+// are resized and redrawn, and Suspend returns.
+// In raw mode, Ctrl-Z is read as byte 26 instead of sending SIGTSTP, so programs
+// that read keys in raw mode can call Suspend when they read that key.
+func (s *Session) Suspend() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	select {
+	case <-s.done:
+		// The session is closed, just stop
+		stopProcess()
+		return
+	default:
+	}
+	// Record the current TTY settings, like raw mode, so that they can be set again
+	current, _ := term.Open("/dev/tty")
+	s.restore()
+	// The program stops here until it is continued
+	stopProcess()
+	if current != nil {
+		current.Restore()
+		current.Close()
+	}
+	s.t.Init()
+	s.redraw()
+	// The SIGCONT that is received after this should not redraw again
+	s.resumed = s.jobControl != nil
+}
+
+// continued redraws the canvases after the program has been stopped and continued
+// by something else than Suspend
+func (s *Session) continued() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.resumed {
+		s.resumed = false
+		return
+	}
+	s.redraw()
+}
+
+// redraw resizes and redraws all canvases given to HandleSuspend. s.mut must be held.
+func (s *Session) redraw() {
+	for _, c := range s.canvases {
+		c.Resize()
+		c.mut.RLock()
+		cursorVisible := c.cursorVisible
+		c.mut.RUnlock()
+		c.SetShowCursor(cursorVisible)
+		c.Redraw()
+	}
+}
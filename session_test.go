@@ -0,0 +1,94 @@
+//go:build !windows
+// +build !windows
+
+package vt100
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSessionClose(t *testing.T) {
+	var buf bytes.Buffer
+	s := StartTerminal(NewTerminal(&buf))
+	if !strings.Contains(buf.String(), "\033[?25l") {
+		t.Errorf("expected the cursor to be hidden when starting, got %q", buf.String())
+	}
+	buf.Reset()
+	// Without a panic, Recover does nothing
+	s.Recover()
+	if got := buf.String(); got != "" {
+		t.Errorf("expected nothing to be written, got %q", got)
+	}
+	s.Close()
+	if got, want := buf.String(), "\033[0m\033[?7h\033[?25h\033[H"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	select {
+	case <-s.done:
+	default:
+		t.Error("expected the signal handler to be stopped")
+	}
+	// Closing again does nothing
+	buf.Reset()
+	s.Close()
+	if got := buf.String(); got != "" {
+		t.Errorf("expected nothing to be written, got %q", got)
+	}
+}
+
+func TestSessionRecover(t *testing.T) {
+	var buf bytes.Buffer
+	s := StartTerminal(NewTerminal(&buf))
+	buf.Reset()
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("expected the panic to continue, got %v", r)
+		}
+		if got, want := buf.String(), "\033[0m\033[?7h\033[?25h\033[H"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}()
+	defer s.Recover()
+	panic("boom")
+}
+
+func TestSessionContinued(t *testing.T) {
+	var buf, canvasBuf bytes.Buffer
+	s := StartTerminal(NewTerminal(&buf))
+	defer s.Close()
+	c := NewCanvasWriter(&canvasBuf, 3, 1)
+	c.Write(0, 0, Default, BackgroundDefault, "abc")
+	c.Draw()
+	s.HandleSuspend(c)
+
+	// Suspend restores the terminal, stops and then sets up the terminal again and redraws
+	stopped := false
+	defer func(stop func()) { stopProcess = stop }(stopProcess)
+	stopProcess = func() { stopped = true }
+	buf.Reset()
+	canvasBuf.Reset()
+	s.Suspend()
+	if !stopped || !strings.HasPrefix(buf.String(), "\033[0m\033[?7h\033[?25h\033[H") || !strings.Contains(canvasBuf.String(), "abc") {
+		t.Errorf("unexpected output: %q and %q", buf.String(), canvasBuf.String())
+	}
+
+	// The SIGCONT that follows Suspend does not redraw again
+	canvasBuf.Reset()
+	s.continued()
+	if got := canvasBuf.String(); got != "" {
+		t.Errorf("expected no redraw, got %q", got)
+	}
+
+	// When the program is continued by something else, the canvases are resized and redrawn
+	c.ResizeTo(3, 1)
+	s.continued()
+	w, h := MustTermSize()
+	if cw, ch := c.Size(); cw != w || ch != h {
+		t.Errorf("expected the canvas to be resized to %dx%d, got %dx%d", w, h, cw, ch)
+	}
+	if got := canvasBuf.String(); !strings.Contains(got, "abc") {
+		t.Errorf("expected the canvas to be redrawn, got %q", got)
+	}
+}
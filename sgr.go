@@ -0,0 +1,357 @@
+package vt100
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Display attribute flags, as tracked by sgrState
+const (
+	attrBright uint16 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderscore
+	attrBlink
+	attrReverse
+	attrHidden
+	attrStrike
+	attrOverline
+)
+
+// The underline styles are set with a sub-parameter, like 4:3 for a curly underline.
+// In an AttributeColor, they are stored as 4, subParam and the style, like {4, subParam, 3},
+// where subParam is a byte that is not used by any SGR parameter.
+const subParam byte = 0xff
+
+// styledUnderline returns the SGR parameters for the given underline style, from 2 to 5
+func styledUnderline(style byte) AttributeColor {
+	return AttributeColor{4, subParam, style}
+}
+
+// underlineStyle returns the underline style of the SGR parameter that starts at params[i],
+// or 0 if it is not a styled underline
+func underlineStyle(params []byte, i int) byte {
+	if params[i] == 4 && i+2 < len(params) && params[i+1] == subParam {
+		return params[i+2]
+	}
+	return 0
+}
+
+// sgrAttributes lists the attribute flags together with the SGR parameters
+// for turning them on and off
+var sgrAttributes = []struct {
+	flag    uint16
+	on, off byte
+}{
+	{attrBright, 1, 22},
+	{attrDim, 2, 22},
+	{attrItalic, 3, 23},
+	{attrUnderscore, 4, 24},
+	{attrBlink, 5, 25},
+	{attrReverse, 7, 27},
+	{attrHidden, 8, 28},
+	{attrStrike, 9, 29},
+	{attrOverline, 53, 55},
+}
+
+// paramLen returns the number of bytes in the SGR parameter that starts at params[i].
+// This is 3 or 5 for extended colors, like 38;5;n or 38;2;r;g;b, 3 for the underline
+// styles and 1 for the rest.
+func paramLen(params []byte, i int) int {
+	if underlineStyle(params, i) != 0 {
+		return 3
+	}
+	if b := params[i]; b == 38 || b == 48 || b == 58 {
+		if i+2 < len(params) && params[i+1] == 5 {
+			return 3
+		} else if i+4 < len(params) && params[i+1] == 2 {
+			return 5
+		}
+	}
+	return 1
+}
+
+// sgrColor holds the SGR parameters for a foreground or background color,
+// like {31}, {38, 5, n} or {38, 2, r, g, b}. The zero value is the default color.
+type sgrColor [5]byte
+
+// params returns the SGR parameters for this color.
+// def is the parameter for the default color (39 or 49).
+func (sc sgrColor) params(def byte) []byte {
+	switch sc[0] {
+	case 0:
+		return []byte{def}
+	case 38, 48, 58:
+		if sc[1] == 5 {
+			return sc[:3]
+		}
+		return sc[:]
+	}
+	return sc[:1]
+}
+
+// sgrState is the set of display attributes and colors that are in effect
+type sgrState struct {
+	attrs   uint16
+	ulStyle byte // the underline style, from 2 to 5, or 0 for a plain underline
+	fg      sgrColor
+	bg      sgrColor
+	ul      sgrColor // the underline color
+}
+
+// appendOn appends the SGR parameter for turning on the given attribute
+func (s *sgrState) appendOn(params []byte, flag uint16, param byte) []byte {
+	if flag == attrUnderscore && s.ulStyle != 0 {
+		return append(params, styledUnderline(s.ulStyle)...)
+	}
+	return append(params, param)
+}
+
+// apply updates the state with the SGR parameters in the given AttributeColor
+func (s *sgrState) apply(ac AttributeColor) {
+	for i := 0; i < len(ac); i++ {
+		b := ac[i]
+		switch {
+		case b == 0:
+			*s = sgrState{}
+		case b == 22:
+			s.attrs &^= attrBright | attrDim
+		case b == 4:
+			s.attrs |= attrUnderscore
+			s.ulStyle = underlineStyle(ac, i)
+			if s.ulStyle != 0 {
+				i += 2
+			}
+		case b == 24:
+			s.attrs &^= attrUnderscore
+			s.ulStyle = 0
+		case (30 <= b && b <= 37) || (90 <= b && b <= 97):
+			s.fg = sgrColor{b}
+		case b == 39:
+			s.fg = sgrColor{}
+		case (40 <= b && b <= 47) || (100 <= b && b <= 107):
+			s.bg = sgrColor{b}
+		case b == 49:
+			s.bg = sgrColor{}
+		case b == 59:
+			s.ul = sgrColor{}
+		case b == 38 || b == 48 || b == 58:
+			var sc sgrColor
+			if i+2 < len(ac) && ac[i+1] == 5 {
+				copy(sc[:], ac[i:i+3])
+				i += 2
+			} else if i+4 < len(ac) && ac[i+1] == 2 {
+				copy(sc[:], ac[i:i+5])
+				i += 4
+			} else {
+				// Incomplete extended color, ignore the rest
+				return
+			}
+			switch b {
+			case 38:
+				s.fg = sc
+			case 48:
+				s.bg = sc
+			default:
+				s.ul = sc
+			}
+		default:
+			for _, a := range sgrAttributes {
+				if b == a.on {
+					s.attrs |= a.flag
+				} else if b == a.off {
+					s.attrs &^= a.flag
+				}
+			}
+		}
+	}
+}
+
+// sgrCaps is what a terminal can show: the color level and the display attributes
+type sgrCaps struct {
+	level           ColorLevel
+	attrs           uint16 // the attribute flags that can be shown
+	underlineStyles bool   // can the underline styles, like curly, be shown?
+	underlineColor  bool   // can the underline color be set?
+}
+
+// allCaps is a terminal that can show all attributes and 24-bit colors
+var allCaps = sgrCaps{level: ColorLevelTrue, attrs: ^uint16(0), underlineStyles: true, underlineColor: true}
+
+// key returns a short string that is different for each set of capabilities
+func (caps sgrCaps) key() string {
+	var flags byte
+	if caps.underlineStyles {
+		flags |= 1
+	}
+	if caps.underlineColor {
+		flags |= 2
+	}
+	return string([]byte{byte(caps.level), byte(caps.attrs), byte(caps.attrs >> 8), flags})
+}
+
+// supports checks if the terminal can show the attribute that the given SGR parameter turns on
+func (caps sgrCaps) supports(param byte) bool {
+	for _, a := range sgrAttributes {
+		if param == a.on {
+			return caps.attrs&a.flag != 0
+		}
+	}
+	return true
+}
+
+// degrade converts the colors of the state to the color level of the terminal and turns
+// off what the terminal can not show. The underline styles become plain underlines.
+func (s sgrState) degrade(caps sgrCaps) sgrState {
+	s = s.downsample(caps.level)
+	s.attrs &= caps.attrs
+	if !caps.underlineStyles || s.attrs&attrUnderscore == 0 {
+		s.ulStyle = 0
+	}
+	if !caps.underlineColor {
+		s.ul = sgrColor{}
+	}
+	return s
+}
+
+// fullParams appends the parameters needed for going from a reset terminal to this state
+func (s *sgrState) fullParams(params []byte) []byte {
+	params = append(params, 0)
+	for _, a := range sgrAttributes {
+		if s.attrs&a.flag != 0 {
+			params = s.appendOn(params, a.flag, a.on)
+		}
+	}
+	if s.fg != (sgrColor{}) {
+		params = append(params, s.fg.params(39)...)
+	}
+	if s.bg != (sgrColor{}) {
+		params = append(params, s.bg.params(49)...)
+	}
+	if s.ul != (sgrColor{}) {
+		params = append(params, s.ul.params(59)...)
+	}
+	return params
+}
+
+// changeParams appends the parameters needed for going from the "from" state
+// to this state, by only turning off and on what differs
+func (s *sgrState) changeParams(params []byte, from *sgrState) []byte {
+	off := from.attrs &^ s.attrs
+	on := s.attrs &^ from.attrs
+	if s.attrs&from.attrs&attrUnderscore != 0 && s.ulStyle != from.ulStyle {
+		// Changing the underline style does not need the underline to be turned off first
+		on |= attrUnderscore
+	}
+	if off&(attrBright|attrDim) != 0 {
+		// 22 turns off both bright and dim, so the one that should stay on must be turned on again
+		params = append(params, 22)
+		on |= s.attrs & (attrBright | attrDim)
+	}
+	for _, a := range sgrAttributes {
+		if off&a.flag != 0 && a.off != 22 {
+			params = append(params, a.off)
+		}
+	}
+	for _, a := range sgrAttributes {
+		if on&a.flag != 0 {
+			params = s.appendOn(params, a.flag, a.on)
+		}
+	}
+	if s.fg != from.fg {
+		params = append(params, s.fg.params(39)...)
+	}
+	if s.bg != from.bg {
+		params = append(params, s.bg.params(49)...)
+	}
+	if s.ul != from.ul {
+		params = append(params, s.ul.params(59)...)
+	}
+	return params
+}
+
+// paramsLen returns the length of the given parameters when they are written out
+func paramsLen(params []byte) int {
+	n := len(params) - 1 // semicolons
+	for _, p := range params {
+		switch {
+		case p == subParam:
+			// The colon of 4:3 replaces two semicolons
+			n--
+		case p >= 100:
+			n += 3
+		case p >= 10:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// writeSGR writes the "Set Attribute Mode" terminal command for the given parameters
+func writeSGR(sb *strings.Builder, params []byte) {
+	var num [3]byte
+	sb.WriteString("\033[")
+	for i := 0; i < len(params); {
+		if i > 0 {
+			sb.WriteByte(';')
+		}
+		if style := underlineStyle(params, i); style != 0 {
+			sb.WriteString("4:")
+			sb.Write(strconv.AppendUint(num[:0], uint64(style), 10))
+			i += 3
+			continue
+		}
+		if n := paramLen(params, i); n > 1 {
+			for j, p := range params[i : i+n] {
+				if j > 0 {
+					sb.WriteByte(';')
+				}
+				sb.Write(strconv.AppendUint(num[:0], uint64(p), 10))
+			}
+			i += n
+			continue
+		}
+		sb.Write(strconv.AppendUint(num[:0], uint64(params[i]), 10))
+		i++
+	}
+	sb.WriteByte('m')
+}
+
+// sgrWriter keeps track of the display attributes and colors that the terminal
+// is using, and writes the shortest terminal command for changing them
+type sgrWriter struct {
+	cur    sgrState
+	known  bool     // is the current state of the terminal known?
+	full   [32]byte // scratch space for parameters
+	change [32]byte // scratch space for parameters
+}
+
+// transition writes the terminal command for going from the current state to the next one.
+// A reset (0) is only used if something must be turned off, and it is shorter than turning
+// off each attribute separately.
+func (w *sgrWriter) transition(sb *strings.Builder, next sgrState) {
+	if w.known && w.cur == next {
+		return
+	}
+	params := next.fullParams(w.full[:0])
+	if w.known {
+		if change := next.changeParams(w.change[:0], &w.cur); paramsLen(change) <= paramsLen(params) {
+			params = change
+		}
+	}
+	writeSGR(sb, params)
+	w.cur = next
+	w.known = true
+}
+
+// reset turns off all attributes and colors, if any have been set
+func (w *sgrWriter) reset(sb *strings.Builder) {
+	if !w.known || w.cur == (sgrState{}) {
+		return
+	}
+	sb.WriteString(NoColor())
+	w.cur = sgrState{}
+	w.known = true
+}
@@ -0,0 +1,505 @@
+package vt100
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	showCursorCode     = "\033[?25h"
+	hideCursorCode     = "\033[?25l"
+	saveCursorCode     = "\0337"
+	restoreCursorCode  = "\0338"
+	enterAltScreenCode = "\033[?1049h"
+	leaveAltScreenCode = "\033[?1049l"
+)
+
+// Terminal is an output device that terminal commands can be sent to.
+// It wraps an io.Writer, like os.Stdout, an SSH session, a pty master,
+// a log file or a bytes.Buffer.
+type Terminal struct {
+	w         io.Writer
+	mut       *sync.Mutex
+	altScreen bool       // should Init and Close use the alternate screen buffer?
+	ti        *Terminfo  // the capabilities of the terminal, or nil for VT100
+	tiOnce    *sync.Once // for loading the terminfo entry for $TERM when it is first needed
+	tiFromEnv bool       // should the terminfo entry for $TERM be used?
+	level     ColorLevel // the color level, if levelSet is true
+	levelSet  bool       // has the color level been set with SetColorLevel?
+	caps      *sgrCaps   // what the terminal can show, or nil if it has not been found out yet
+}
+
+// stdoutWriter writes to whatever os.Stdout is at the time of writing,
+// just like fmt.Print does
+type stdoutWriter struct{}
+
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdoutWriter) file() *os.File {
+	return os.Stdout
+}
+
+// stderrWriter writes to whatever os.Stderr is at the time of writing
+type stderrWriter struct{}
+
+func (stderrWriter) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+func (stderrWriter) file() *os.File {
+	return os.Stderr
+}
+
+// stdoutTerminal is used by the package-level functions, like SetXY and Do.
+// It uses the terminfo entry for $TERM.
+var stdoutTerminal = &Terminal{w: stdoutWriter{}, mut: &sync.Mutex{}, tiOnce: &sync.Once{}, tiFromEnv: true}
+
+// stderrTerminal is used for finding out what can be shown when writing to stderr,
+// like AttributeColor.Error does. It uses the terminfo entry for $TERM.
+var stderrTerminal = &Terminal{w: stderrWriter{}, mut: &sync.Mutex{}, tiOnce: &sync.Once{}, tiFromEnv: true}
+
+// terminalFor returns the terminal that writes to the given writer. Writers that are
+// not a Terminal or stderr get the terminal that the package-level functions use.
+func terminalFor(w io.Writer) *Terminal {
+	switch w := w.(type) {
+	case *Terminal:
+		return w
+	case stderrWriter:
+		return stderrTerminal
+	case *os.File:
+		if w == os.Stderr {
+			return stderrTerminal
+		}
+	}
+	return stdoutTerminal
+}
+
+// NewTerminal creates a new Terminal that sends all output to the given io.Writer.
+// VT100 sequences are used, unless SetTerminfo or LoadTerminfo is called.
+func NewTerminal(w io.Writer) *Terminal {
+	return &Terminal{w: w, mut: &sync.Mutex{}, tiOnce: &sync.Once{}}
+}
+
+// StdoutTerminal returns the Terminal that the package-level functions use
+func StdoutTerminal() *Terminal {
+	return stdoutTerminal
+}
+
+// SetTerminfo sets the terminfo entry that is used for looking up the terminal commands
+// and capabilities. If it is nil, VT100 sequences are used.
+func (t *Terminal) SetTerminfo(ti *Terminfo) {
+	t.tiOnce.Do(func() {})
+	t.mut.Lock()
+	t.ti = ti
+	t.caps = nil
+	t.mut.Unlock()
+}
+
+// LoadTerminfo loads and uses the terminfo entry for the given terminal name, like "screen".
+// If there is no entry, an error is returned and the current one is kept.
+func (t *Terminal) LoadTerminfo(name string) error {
+	ti, err := LoadTerminfo(name)
+	if err != nil {
+		return err
+	}
+	t.SetTerminfo(ti)
+	return nil
+}
+
+// Terminfo returns the terminfo entry that is used, or nil if VT100 sequences are used
+func (t *Terminal) Terminfo() *Terminfo {
+	t.tiOnce.Do(func() {
+		if !t.tiFromEnv {
+			return
+		}
+		if ti, err := LoadTerminfo(os.Getenv("TERM")); err == nil {
+			t.mut.Lock()
+			t.ti = ti
+			t.mut.Unlock()
+		}
+	})
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.ti
+}
+
+// sequence returns the escape sequence for the given command, from the terminfo entry
+// if there is one, or else the VT100 sequence
+func (t *Terminal) sequence(cmd *Command, args ...uint) string {
+	if ti := t.Terminfo(); ti != nil {
+		if s, ok := ti.command(cmd.Name, args...); ok {
+			return s
+		}
+	}
+	return cmd.Sequence(args...)
+}
+
+// ColorCount returns the number of colors that the terminal supports, according to
+// terminfo, or 8 if VT100 sequences are used
+func (t *Terminal) ColorCount() int {
+	if ti := t.Terminfo(); ti != nil {
+		return ti.Numbers["colors"]
+	}
+	return 8
+}
+
+// ColorLevel returns the color level of the terminal, which the colors that are drawn
+// are converted to. If it has not been set with SetColorLevel, it is detected from
+// $COLORTERM, $TERM and the terminfo entry for the terminal that the package-level
+// functions use, or from the terminfo entry for other terminals. Other terminals
+// without a terminfo entry get ColorLevelTrue, so that the colors are not converted.
+// If colors are forced for stdout (see ColorEnabled), the terminal that the
+// package-level functions use gets at least ColorLevel16, and the same for stderr.
+func (t *Terminal) ColorLevel() ColorLevel {
+	ti := t.Terminfo()
+	t.mut.Lock()
+	level, levelSet, fromEnv := t.level, t.levelSet, t.tiFromEnv
+	t.mut.Unlock()
+	switch {
+	case levelSet:
+		return level
+	case fromEnv:
+		level := detectColorLevel(os.Getenv("COLORTERM"), os.Getenv("TERM"), ti)
+		if f, ok := t.w.(interface{ file() *os.File }); ok && level < ColorLevel16 && colorForced(f.file()) {
+			// Colors have been asked for, even if $TERM does not say that there are any
+			level = ColorLevel16
+		}
+		return level
+	case ti != nil:
+		return detectColorLevel("", ti.Name(), ti)
+	}
+	return ColorLevelTrue
+}
+
+// SetColorLevel sets the color level of the terminal, instead of detecting it
+func (t *Terminal) SetColorLevel(level ColorLevel) {
+	t.mut.Lock()
+	t.level, t.levelSet = level, true
+	t.caps = nil
+	t.mut.Unlock()
+}
+
+// HasItalics returns true if the terminal supports italic text, according to terminfo.
+// Returns false if VT100 sequences are used.
+func (t *Terminal) HasItalics() bool {
+	if ti := t.Terminfo(); ti != nil {
+		return ti.Has("sitm")
+	}
+	return false
+}
+
+// sgrCaps returns what the terminal can show, according to the color level and terminfo.
+// Everything is shown if VT100 sequences are used. It is found out once, and again after
+// SetColorLevel, SetTerminfo,
+// SetColorMode or SetWriterColorMode.
+func (t *Terminal) sgrCaps() sgrCaps {
+	t.mut.Lock()
+	cached := t.caps
+	t.mut.Unlock()
+	if cached != nil {
+		return *cached
+	}
+	caps := t.detectSGRCaps()
+	t.mut.Lock()
+	t.caps = &caps
+	t.mut.Unlock()
+	return caps
+}
+
+// resetCaps makes sgrCaps find out again what the terminal can show
+func (t *Terminal) resetCaps() {
+	t.mut.Lock()
+	t.caps = nil
+	t.mut.Unlock()
+}
+
+// detectSGRCaps finds out what the terminal can show
+func (t *Terminal) detectSGRCaps() sgrCaps {
+	caps := allCaps
+	caps.level = t.ColorLevel()
+	ti := t.Terminfo()
+	if ti == nil {
+		return caps
+	}
+	for _, c := range []struct {
+		flag    uint16
+		capname string
+	}{
+		{attrItalic, "sitm"},
+		{attrStrike, "smxx"},
+		{attrOverline, "Smol"},
+	} {
+		if !ti.Has(c.capname) {
+			caps.attrs &^= c.flag
+		}
+	}
+	// Smulx sets the underline style, and Su is set by some terminals that support it
+	caps.underlineStyles = ti.Has("Smulx") || ti.Has("Su")
+	caps.underlineColor = ti.Has("Setulc")
+	return caps
+}
+
+// HasAlternateScreen returns true if the terminal has an alternate screen buffer,
+// according to terminfo. Returns true if VT100 (xterm) sequences are used.
+func (t *Terminal) HasAlternateScreen() bool {
+	if ti := t.Terminfo(); ti != nil {
+		return ti.Has("smcup")
+	}
+	return true
+}
+
+// Writer returns the underlying io.Writer
+func (t *Terminal) Writer() io.Writer {
+	return t.w
+}
+
+// Write writes the given bytes to the terminal, as one single write
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.w.Write(p)
+}
+
+// Print writes the given string to the terminal
+func (t *Terminal) Print(s string) {
+	if s == "" {
+		return
+	}
+	t.Write([]byte(s))
+}
+
+// Set does the terminal command, given a map to replace the values mentioned in the spec.
+func (t *Terminal) Set(command string, replacemap map[string]string) {
+	t.Print(get(command, replacemap))
+}
+
+// Do the given command, with no parameters
+func (t *Terminal) Do(command string) {
+	if i, ok := commandIndex[command]; ok {
+		t.Print(t.sequence(&commandTable[i]))
+	}
+}
+
+// Send sends the terminal command with the given name, like "Cursor Up", and parameters.
+// Returns an error if there is no command with that name, or if some, but not all,
+// of the parameters are given.
+func (t *Terminal) Send(command string, args ...uint) error {
+	return send(t, command, args...)
+}
+
+// SetXY moves the cursor to the given position (0,0 is top left)
+func (t *Terminal) SetXY(x, y uint) {
+	t.Print(t.sequence(cmdCursorHome, y+1, x+1))
+}
+
+// Down moves the cursor down
+func (t *Terminal) Down(n uint) {
+	t.Print(t.sequence(cmdCursorDown, n))
+}
+
+// Up moves the cursor up
+func (t *Terminal) Up(n uint) {
+	t.Print(t.sequence(cmdCursorUp, n))
+}
+
+// Right moves the cursor to the right
+func (t *Terminal) Right(n uint) {
+	t.Print(t.sequence(cmdCursorForward, n))
+}
+
+// Left moves the cursor to the left
+func (t *Terminal) Left(n uint) {
+	t.Print(t.sequence(cmdCursorBackward, n))
+}
+
+// Home moves the cursor to the upper left corner
+func (t *Terminal) Home() {
+	t.Print(t.sequence(cmdCursorHome))
+}
+
+// Column moves the cursor to column x of the current row (0 is the leftmost column)
+func (t *Terminal) Column(x uint) {
+	t.Print(t.sequence(cmdCursorColumn, x+1))
+}
+
+// Row moves the cursor to row y, without changing the column (0 is the top row)
+func (t *Terminal) Row(y uint) {
+	t.Print(t.sequence(cmdCursorRow, y+1))
+}
+
+// NextLine moves the cursor to the start of the line n rows down
+func (t *Terminal) NextLine(n uint) {
+	t.Print(t.sequence(cmdCursorNextLine, n))
+}
+
+// PreviousLine moves the cursor to the start of the line n rows up
+func (t *Terminal) PreviousLine(n uint) {
+	t.Print(t.sequence(cmdCursorPrevLine, n))
+}
+
+// InsertLines inserts n blank lines at the cursor, moving the lines below down
+func (t *Terminal) InsertLines(n uint) {
+	t.Print(t.sequence(cmdInsertLines, n))
+}
+
+// DeleteLines deletes n lines, starting with the line of the cursor, moving the lines below up
+func (t *Terminal) DeleteLines(n uint) {
+	t.Print(t.sequence(cmdDeleteLines, n))
+}
+
+// InsertChars inserts n blank characters at the cursor, moving the rest of the line to the right
+func (t *Terminal) InsertChars(n uint) {
+	t.Print(t.sequence(cmdInsertChars, n))
+}
+
+// DeleteChars deletes n characters at the cursor, moving the rest of the line to the left
+func (t *Terminal) DeleteChars(n uint) {
+	t.Print(t.sequence(cmdDeleteChars, n))
+}
+
+// EraseChars erases n characters, starting at the cursor
+func (t *Terminal) EraseChars(n uint) {
+	t.Print(t.sequence(cmdEraseChars, n))
+}
+
+// ScrollUp scrolls the display (or the scroll region) up n lines
+func (t *Terminal) ScrollUp(n uint) {
+	t.Print(t.sequence(cmdScrollUp, n))
+}
+
+// ScrollDown scrolls the display (or the scroll region) down n lines
+func (t *Terminal) ScrollDown(n uint) {
+	t.Print(t.sequence(cmdScrollDown, n))
+}
+
+// SoftReset resets the display attributes, modes, scroll region and saved cursor,
+// without clearing the screen
+func (t *Terminal) SoftReset() {
+	t.Print(DECSTR())
+}
+
+// Reset resets all terminal settings to default
+func (t *Terminal) Reset() {
+	t.Do("Reset Device")
+}
+
+// Clear erases the screen
+func (t *Terminal) Clear() {
+	t.Do("Erase Screen")
+}
+
+// SetLineWrap enables or disables line wrapping
+func (t *Terminal) SetLineWrap(enable bool) {
+	if enable {
+		t.Do("Enable Line Wrap")
+	} else {
+		t.Do("Disable Line Wrap")
+	}
+}
+
+// ShowCursor shows or hides the cursor
+func (t *Terminal) ShowCursor(enable bool) {
+	// Thanks https://rosettacode.org/wiki/Terminal_control/Hiding_the_cursor#Escape_code
+	if enable {
+		t.Print(t.sequence(cmdShowCursor))
+	} else {
+		t.Print(t.sequence(cmdHideCursor))
+	}
+}
+
+// EchoOff disables the local echo
+func (t *Terminal) EchoOff() {
+	t.Do("Disable Local Echo")
+}
+
+// SetColorNum sets the given color number
+func (t *Terminal) SetColorNum(colorNum int) {
+	t.Print(ColorNum(colorNum))
+}
+
+// SetAttribute sets a given display attribute name, like "Bright" or "Blink"
+func (t *Terminal) SetAttribute(name string) {
+	t.Print(AttributeOrColor(name))
+}
+
+// SetAttributeAndColor sets a terminal attribute and a color
+func (t *Terminal) SetAttributeAndColor(attr, name string) {
+	t.Print(AttributeAndColor(attr, name))
+}
+
+// SetNoColor resets all colors and other display attributes
+func (t *Terminal) SetNoColor() {
+	t.Print(NoColor())
+}
+
+// SaveCursor saves the cursor position and the display attributes
+func (t *Terminal) SaveCursor() {
+	t.Print(t.sequence(cmdSaveCursor))
+}
+
+// RestoreCursor restores the cursor position and the display attributes that were saved with SaveCursor
+func (t *Terminal) RestoreCursor() {
+	t.Print(t.sequence(cmdRestoreCursor))
+}
+
+// EnterAlternateScreen switches to the alternate screen buffer, which has no scrollback.
+// What was on the screen before is shown again when LeaveAlternateScreen is called.
+func (t *Terminal) EnterAlternateScreen() {
+	t.Print(t.sequence(cmdEnterAltScreen))
+}
+
+// LeaveAlternateScreen switches back to the normal screen buffer
+func (t *Terminal) LeaveAlternateScreen() {
+	t.Print(t.sequence(cmdLeaveAltScreen))
+}
+
+// UseAlternateScreen makes Init enter the alternate screen buffer and Close leave it,
+// while saving and restoring the cursor. This keeps the screen contents and scrollback
+// of the shell intact, like vim and less do. It is disabled by default.
+func (t *Terminal) UseAlternateScreen(enable bool) {
+	t.mut.Lock()
+	t.altScreen = enable
+	t.mut.Unlock()
+}
+
+// usesAlternateScreen returns true if Init and Close should use the alternate screen buffer
+func (t *Terminal) usesAlternateScreen() bool {
+	t.mut.Lock()
+	altScreen := t.altScreen
+	t.mut.Unlock()
+	return altScreen && t.HasAlternateScreen()
+}
+
+// Init resets the terminal, clears the screen, hides the cursor and disables line wrap.
+// If UseAlternateScreen has been enabled, the cursor is saved and the alternate screen
+// buffer is used instead of resetting the terminal.
+func (t *Terminal) Init() {
+	if t.usesAlternateScreen() {
+		t.SaveCursor()
+		t.EnterAlternateScreen()
+		t.Home()
+	} else {
+		t.Reset()
+	}
+	t.Clear()
+	t.ShowCursor(false)
+	t.SetLineWrap(false)
+	t.EchoOff()
+}
+
+// Close enables line wrap, shows the cursor and moves the cursor to the upper left corner.
+// If UseAlternateScreen has been enabled, the normal screen buffer and the cursor
+// are restored instead of moving the cursor.
+func (t *Terminal) Close() {
+	t.SetLineWrap(true)
+	t.ShowCursor(true)
+	if t.usesAlternateScreen() {
+		t.LeaveAlternateScreen()
+		t.RestoreCursor()
+	} else {
+		t.Home()
+	}
+}
@@ -0,0 +1,565 @@
+package vt100
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The magic numbers of compiled terminfo entries
+const (
+	terminfoMagic         = 0432  // the legacy format, with 16-bit numbers
+	terminfoExtendedMagic = 01036 // the format with 32-bit numbers
+)
+
+// ErrNoTerminfo is returned by LoadTerminfo if there is no terminfo entry for the terminal
+var ErrNoTerminfo = errors.New("no terminfo entry found")
+
+// Terminfo is a compiled terminfo entry, which describes the capabilities of a terminal.
+// The capabilities are stored by their short names, like "cup" or "colors".
+// Extended capabilities, like "Tc" or "Smulx", are included.
+type Terminfo struct {
+	Names   []string // the name of the terminal, followed by aliases and a description
+	Bools   map[string]bool
+	Numbers map[string]int
+	Strings map[string]string
+}
+
+// terminfoDirs returns the directories to search for terminfo entries, in order
+func terminfoDirs() []string {
+	var dirs []string
+	if dir := os.Getenv("TERMINFO"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".terminfo"))
+	}
+	if list := os.Getenv("TERMINFO_DIRS"); list != "" {
+		for _, dir := range strings.Split(list, ":") {
+			if dir == "" {
+				// An empty entry means the system directory
+				dir = "/usr/share/terminfo"
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, "/etc/terminfo", "/lib/terminfo", "/usr/share/terminfo", "/usr/lib/terminfo")
+}
+
+// LoadTerminfo finds and reads the compiled terminfo entry for the given terminal name,
+// like "xterm-256color". The entries are searched for in $TERMINFO, ~/.terminfo,
+// $TERMINFO_DIRS and the system directories, both in directories named after the first
+// letter of the name and in directories named after its hex value (as on macOS).
+// Returns ErrNoTerminfo if no entry was found.
+func LoadTerminfo(name string) (*Terminfo, error) {
+	if name == "" || strings.ContainsRune(name, '/') || strings.HasPrefix(name, ".") {
+		return nil, ErrNoTerminfo
+	}
+	for _, dir := range terminfoDirs() {
+		for _, sub := range []string{name[:1], fmt.Sprintf("%02x", name[0])} {
+			data, err := os.ReadFile(filepath.Join(dir, sub, name))
+			if err != nil {
+				continue
+			}
+			return ParseTerminfo(data)
+		}
+	}
+	return nil, ErrNoTerminfo
+}
+
+// terminfoReader reads the parts of a compiled terminfo entry
+type terminfoReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// bytes returns the next n bytes
+func (r *terminfoReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errors.New("terminfo entry is truncated")
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// align skips to the next even position
+func (r *terminfoReader) align() {
+	if r.pos%2 == 1 && r.pos < len(r.data) {
+		r.pos++
+	}
+}
+
+// shorts returns the next n signed 16-bit numbers
+func (r *terminfoReader) shorts(n int) []int {
+	b := r.bytes(2 * n)
+	if b == nil {
+		return nil
+	}
+	values := make([]int, n)
+	for i := range values {
+		values[i] = int(int16(binary.LittleEndian.Uint16(b[2*i:])))
+	}
+	return values
+}
+
+// numbers returns the next n signed numbers, which are 16-bit or 32-bit
+func (r *terminfoReader) numbers(n int, extended bool) []int {
+	if !extended {
+		return r.shorts(n)
+	}
+	b := r.bytes(4 * n)
+	if b == nil {
+		return nil
+	}
+	values := make([]int, n)
+	for i := range values {
+		values[i] = int(int32(binary.LittleEndian.Uint32(b[4*i:])))
+	}
+	return values
+}
+
+// cstring returns the NUL-terminated string at the given offset of the table
+func cstring(table []byte, offset int) (string, bool) {
+	if offset < 0 || offset >= len(table) {
+		return "", false
+	}
+	s := table[offset:]
+	if end := strings.IndexByte(string(s), 0); end != -1 {
+		s = s[:end]
+	}
+	return string(s), true
+}
+
+// ParseTerminfo parses a compiled terminfo entry, in the legacy format or in the
+// format with 32-bit numbers, including the extended capabilities
+func ParseTerminfo(data []byte) (*Terminfo, error) {
+	r := &terminfoReader{data: data}
+	header := r.shorts(6)
+	if r.err != nil {
+		return nil, r.err
+	}
+	var extended bool
+	switch header[0] {
+	case terminfoMagic:
+	case terminfoExtendedMagic:
+		extended = true
+	default:
+		return nil, fmt.Errorf("not a compiled terminfo entry, the magic number is %#o", header[0])
+	}
+	nameSize, boolCount, numCount, strCount, tableSize := header[1], header[2], header[3], header[4], header[5]
+	ti := &Terminfo{
+		Bools:   make(map[string]bool),
+		Numbers: make(map[string]int),
+		Strings: make(map[string]string),
+	}
+	names, _ := cstring(r.bytes(nameSize), 0)
+	ti.Names = strings.Split(names, "|")
+	bools := r.bytes(boolCount)
+	r.align()
+	nums := r.numbers(numCount, extended)
+	offsets := r.shorts(strCount)
+	table := r.bytes(tableSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+	for i, b := range bools {
+		if i < len(terminfoBoolNames) && b == 1 {
+			ti.Bools[terminfoBoolNames[i]] = true
+		}
+	}
+	for i, n := range nums {
+		if i < len(terminfoNumberNames) && n >= 0 {
+			ti.Numbers[terminfoNumberNames[i]] = n
+		}
+	}
+	for i, offset := range offsets {
+		if s, ok := cstring(table, offset); ok && i < len(terminfoStringNames) {
+			ti.Strings[terminfoStringNames[i]] = s
+		}
+	}
+	r.align()
+	if r.pos+10 <= len(data) {
+		if err := ti.parseExtended(r, extended); err != nil {
+			return nil, err
+		}
+	}
+	return ti, nil
+}
+
+// parseExtended parses the extended capabilities, which come after the standard ones
+// and are stored together with their names
+func (ti *Terminfo) parseExtended(r *terminfoReader, extended bool) error {
+	header := r.shorts(5)
+	if r.err != nil {
+		return r.err
+	}
+	boolCount, numCount, strCount, tableSize := header[0], header[1], header[2], header[4]
+	bools := r.bytes(boolCount)
+	r.align()
+	nums := r.numbers(numCount, extended)
+	offsets := r.shorts(strCount)
+	nameOffsets := r.shorts(boolCount + numCount + strCount)
+	table := r.bytes(tableSize)
+	if r.err != nil {
+		return r.err
+	}
+	// The names come after the string values
+	namesStart := 0
+	for _, offset := range offsets {
+		if s, ok := cstring(table, offset); ok && offset+len(s)+1 > namesStart {
+			namesStart = offset + len(s) + 1
+		}
+	}
+	if namesStart > len(table) {
+		return errors.New("terminfo entry has invalid extended capabilities")
+	}
+	names := make([]string, len(nameOffsets))
+	for i, offset := range nameOffsets {
+		names[i], _ = cstring(table[namesStart:], offset)
+	}
+	for i, b := range bools {
+		if b == 1 {
+			ti.Bools[names[i]] = true
+		}
+	}
+	for i, n := range nums {
+		if n >= 0 {
+			ti.Numbers[names[boolCount+i]] = n
+		}
+	}
+	for i, offset := range offsets {
+		if s, ok := cstring(table, offset); ok {
+			ti.Strings[names[boolCount+numCount+i]] = s
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the terminal, like "xterm-256color"
+func (ti *Terminfo) Name() string {
+	if len(ti.Names) == 0 {
+		return ""
+	}
+	return ti.Names[0]
+}
+
+// Has returns true if the terminal has the given capability, of any type
+func (ti *Terminfo) Has(capname string) bool {
+	if ti.Bools[capname] {
+		return true
+	}
+	if _, ok := ti.Numbers[capname]; ok {
+		return true
+	}
+	_, ok := ti.Strings[capname]
+	return ok
+}
+
+// Parm returns the given string capability, with the parameters filled in.
+// Padding, like "$<5>", is removed. Returns "" if the terminal does not have the capability.
+func (ti *Terminfo) Parm(capname string, args ...int) string {
+	s, ok := ti.Strings[capname]
+	if !ok {
+		return ""
+	}
+	return tparm(stripPadding(s), args...)
+}
+
+// stripPadding removes the padding delays, like "$<5>" or "$<2*/>", from a capability
+func stripPadding(s string) string {
+	for {
+		start := strings.Index(s, "$<")
+		if start == -1 {
+			return s
+		}
+		end := strings.IndexByte(s[start:], '>')
+		if end == -1 {
+			return s
+		}
+		s = s[:start] + s[start+end+1:]
+	}
+}
+
+// tparm fills in the parameters of a terminfo string capability, by interpreting
+// the % codes, like "%p1%d" or "%?%p1%{8}%<%t...%;"
+func tparm(s string, args ...int) string {
+	var (
+		sb      strings.Builder
+		params  [9]int
+		stack   []int
+		dynamic [26]int
+		static  [26]int
+	)
+	copy(params[:], args)
+	push := func(v int) {
+		stack = append(stack, v)
+	}
+	pop := func() int {
+		if len(stack) == 0 {
+			return 0
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	boolInt := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 >= len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case '%':
+			sb.WriteByte('%')
+		case 'c':
+			sb.WriteByte(byte(pop()))
+		case 'p':
+			if i+1 < len(s) && s[i+1] >= '1' && s[i+1] <= '9' {
+				i++
+				push(params[s[i]-'1'])
+			}
+		case 'P', 'g':
+			if i+1 >= len(s) {
+				break
+			}
+			i++
+			var vars *[26]int
+			switch v := s[i]; {
+			case v >= 'a' && v <= 'z':
+				vars = &dynamic
+			case v >= 'A' && v <= 'Z':
+				vars = &static
+			default:
+				continue
+			}
+			index := (s[i] | 0x20) - 'a'
+			if c == 'P' {
+				vars[index] = pop()
+			} else {
+				push(vars[index])
+			}
+		case '\'':
+			if i+2 < len(s) {
+				push(int(s[i+1]))
+				i += 2
+			}
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				break
+			}
+			n, _ := strconv.Atoi(s[i+1 : i+end])
+			push(n)
+			i += end
+		case 'l':
+			push(len(strconv.Itoa(pop())))
+		case '+', '-', '*', '/', 'm', '&', '|', '^', '=', '>', '<', 'A', 'O':
+			b, a := pop(), pop()
+			switch c {
+			case '+':
+				push(a + b)
+			case '-':
+				push(a - b)
+			case '*':
+				push(a * b)
+			case '/':
+				if b == 0 {
+					push(0)
+				} else {
+					push(a / b)
+				}
+			case 'm':
+				if b == 0 {
+					push(0)
+				} else {
+					push(a % b)
+				}
+			case '&':
+				push(a & b)
+			case '|':
+				push(a | b)
+			case '^':
+				push(a ^ b)
+			case '=':
+				push(boolInt(a == b))
+			case '>':
+				push(boolInt(a > b))
+			case '<':
+				push(boolInt(a < b))
+			case 'A':
+				push(boolInt(a != 0 && b != 0))
+			case 'O':
+				push(boolInt(a != 0 || b != 0))
+			}
+		case '!':
+			push(boolInt(pop() == 0))
+		case '~':
+			push(^pop())
+		case 'i':
+			params[0]++
+			params[1]++
+		case '?', ';':
+		case 't':
+			if pop() == 0 {
+				// Skip to the else part, or to the end of the conditional
+				i = skipConditional(s, i+1, true)
+			}
+		case 'e':
+			// The then part is done, skip to the end of the conditional
+			i = skipConditional(s, i+1, false)
+		default:
+			// %[[:]flags][width[.precision]][doxXs]
+			start, flags := i, "# "
+			if c == ':' {
+				// The - and + flags must come after a colon, so that they are not operators
+				i++
+				flags = "-+# "
+			}
+			for i < len(s) && strings.IndexByte(flags, s[i]) != -1 {
+				i++
+			}
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+			if i >= len(s) || strings.IndexByte("doxXs", s[i]) == -1 {
+				// Not a known code
+				i = start
+				break
+			}
+			spec := "%" + strings.TrimPrefix(s[start:i], ":")
+			if s[i] == 's' {
+				fmt.Fprintf(&sb, spec+"s", strconv.Itoa(pop()))
+			} else {
+				fmt.Fprintf(&sb, spec+string(s[i]), pop())
+			}
+		}
+	}
+	return sb.String()
+}
+
+// skipConditional returns the position of the last byte of the %; that ends the
+// conditional that position i is in, or of the %e that starts its else part,
+// if elseToo is true
+func skipConditional(s string, i int, elseToo bool) int {
+	level := 0
+	for ; i+1 < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		i++
+		switch s[i] {
+		case '\'':
+			i += 2
+		case '?':
+			level++
+		case ';':
+			if level == 0 {
+				return i
+			}
+			level--
+		case 'e':
+			if level == 0 && elseToo {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// terminfoCommand is how a terminal command is looked up in a terminfo entry.
+// parm is the capability that takes the parameters, and bare is the capability for
+// when no parameters are given. Positions are 1-based for the terminal commands and
+// 0-based in terminfo, so origin is subtracted from the parameters. If count is true,
+// the parameter is a count, which is 1 if it is not given, and bare does the same
+// thing as parm with a count of 1.
+type terminfoCommand struct {
+	parm   string
+	bare   string
+	origin int
+	count  bool
+}
+
+// terminfoCommands are the terminal commands that can be looked up in a terminfo entry.
+// The other commands are always sent as VT100 sequences. "Erase Screen" is one of them,
+// since the terminfo clear capability also moves the cursor home. cud1, ind and ri are
+// not used, since they are often a newline, or only scroll at the edge of the screen.
+var terminfoCommands = map[string]terminfoCommand{
+	"Reset Device":               {bare: "rs1"},
+	"Enable Line Wrap":           {bare: "smam"},
+	"Disable Line Wrap":          {bare: "rmam"},
+	"Show Cursor":                {bare: "cnorm"},
+	"Hide Cursor":                {bare: "civis"},
+	"Enter Alternate Screen":     {bare: "smcup"},
+	"Leave Alternate Screen":     {bare: "rmcup"},
+	"Cursor Home":                {parm: "cup", bare: "home", origin: 1},
+	"Force Cursor Position":      {parm: "cup", bare: "home", origin: 1},
+	"Cursor Up":                  {parm: "cuu", bare: "cuu1", count: true},
+	"Cursor Down":                {parm: "cud", count: true},
+	"Cursor Forward":             {parm: "cuf", bare: "cuf1", count: true},
+	"Cursor Backward":            {parm: "cub", bare: "cub1", count: true},
+	"Cursor Horizontal Absolute": {parm: "hpa", origin: 1},
+	"Line Position Absolute":     {parm: "vpa", origin: 1},
+	"Save Cursor & Attrs":        {bare: "sc"},
+	"Restore Cursor & Attrs":     {bare: "rc"},
+	"Scroll Region":              {parm: "csr", origin: 1},
+	"Scroll Up":                  {parm: "indn", count: true},
+	"Scroll Down":                {parm: "rin", count: true},
+	"Set Tab":                    {bare: "hts"},
+	"Clear All Tabs":             {bare: "tbc"},
+	"Erase End of Line":          {bare: "el"},
+	"Erase Start of Line":        {bare: "el1"},
+	"Erase Down":                 {bare: "ed"},
+	"Erase Characters":           {parm: "ech", count: true},
+	"Insert Lines":               {parm: "il", bare: "il1", count: true},
+	"Delete Lines":               {parm: "dl", bare: "dl1", count: true},
+	"Insert Characters":          {parm: "ich", bare: "ich1", count: true},
+	"Delete Characters":          {parm: "dch", bare: "dch1", count: true},
+}
+
+// command returns the escape sequence for the given terminal command from the terminfo
+// entry, and true. Returns false if the command can not be looked up in terminfo, or if
+// the terminal does not have the capability, so that the VT100 sequence can be used.
+// If the terminal only has the capability without parameters, like "cuu1" instead of "cuu",
+// it is repeated as many times as the count that is given.
+func (ti *Terminfo) command(name string, args ...uint) (string, bool) {
+	tc, ok := terminfoCommands[name]
+	if !ok {
+		return "", false
+	}
+	if len(args) == 0 {
+		if ti.Has(tc.bare) {
+			return ti.Parm(tc.bare), true
+		}
+		if !tc.count {
+			return "", false
+		}
+		args = []uint{1}
+	}
+	if ti.Has(tc.parm) {
+		params := make([]int, len(args))
+		for i, arg := range args {
+			params[i] = int(arg) - tc.origin
+		}
+		return ti.Parm(tc.parm, params...), true
+	}
+	if len(args) == 1 && tc.count && ti.Has(tc.bare) {
+		return strings.Repeat(ti.Parm(tc.bare), int(args[0])), true
+	}
+	return "", false
+}
@@ -0,0 +1,214 @@
+package vt100
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// compileTerminfo creates a compiled terminfo entry in the legacy format, with the
+// given standard capabilities and one extended boolean and one extended string
+func compileTerminfo(names string, bools map[int]bool, nums map[int]int, strs map[int]string) []byte {
+	var buf bytes.Buffer
+	put := func(v int) {
+		binary.Write(&buf, binary.LittleEndian, int16(v))
+	}
+	table := func(values []string) ([]int, []byte) {
+		var offsets []int
+		var tb []byte
+		for _, v := range values {
+			if v == "" {
+				offsets = append(offsets, -1)
+				continue
+			}
+			offsets = append(offsets, len(tb))
+			tb = append(append(tb, v...), 0)
+		}
+		return offsets, tb
+	}
+	strValues := make([]string, len(terminfoStringNames))
+	for i, s := range strs {
+		strValues[i] = s
+	}
+	offsets, tb := table(strValues)
+	put(terminfoMagic)
+	put(len(names) + 1)
+	put(len(terminfoBoolNames))
+	put(len(terminfoNumberNames))
+	put(len(offsets))
+	put(len(tb))
+	buf.WriteString(names)
+	buf.WriteByte(0)
+	for i := range terminfoBoolNames {
+		if bools[i] {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	}
+	if buf.Len()%2 == 1 {
+		buf.WriteByte(0)
+	}
+	for i := range terminfoNumberNames {
+		if n, ok := nums[i]; ok {
+			put(n)
+		} else {
+			put(-1)
+		}
+	}
+	for _, offset := range offsets {
+		put(offset)
+	}
+	buf.Write(tb)
+	if buf.Len()%2 == 1 {
+		buf.WriteByte(0)
+	}
+	// The extended capabilities: the Tc boolean and the Smulx string
+	extOffsets, extTable := table([]string{"\033[4:%p1%dm", "Tc", "Smulx"})
+	put(1)
+	put(0)
+	put(1)
+	put(len(extOffsets))
+	put(len(extTable))
+	buf.WriteByte(1)
+	buf.WriteByte(0)
+	put(extOffsets[0])
+	put(0)
+	put(len("Tc") + 1)
+	buf.Write(extTable)
+	return buf.Bytes()
+}
+
+func testTerminfo() []byte {
+	return compileTerminfo("test|Test terminal",
+		map[int]bool{1: true},     // am
+		map[int]int{0: 80, 13: 8}, // cols, colors
+		map[int]string{5: "\033[H\033[2J$<50>", // clear
+			10: "\033[%i%p1%d;%p2%dH", // cup
+			19: "\033[A",              // cuu1
+		})
+}
+
+func TestParseTerminfo(t *testing.T) {
+	ti, err := ParseTerminfo(testTerminfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Name() != "test" || len(ti.Names) != 2 {
+		t.Errorf("unexpected names: %q", ti.Names)
+	}
+	if !ti.Bools["am"] || ti.Bools["bw"] {
+		t.Errorf("unexpected booleans: %v", ti.Bools)
+	}
+	if ti.Numbers["cols"] != 80 || ti.Numbers["colors"] != 8 || ti.Has("lines") {
+		t.Errorf("unexpected numbers: %v", ti.Numbers)
+	}
+	if !ti.Bools["Tc"] || ti.Strings["Smulx"] != "\033[4:%p1%dm" {
+		t.Errorf("unexpected extended capabilities: %v %q", ti.Bools, ti.Strings)
+	}
+	if got, want := ti.Parm("clear"), "\033[H\033[2J"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := ti.Parm("cup", 4, 9), "\033[5;10H"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := ParseTerminfo([]byte("not terminfo")); err == nil {
+		t.Error("expected an error for a file that is not a terminfo entry")
+	}
+	if _, err := ParseTerminfo(testTerminfo()[:40]); err == nil {
+		t.Error("expected an error for a truncated terminfo entry")
+	}
+}
+
+func TestLoadTerminfo(t *testing.T) {
+	dir := t.TempDir()
+	// The directory is named after the hex value of the first letter, like on macOS
+	if err := os.MkdirAll(filepath.Join(dir, "74"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "74", "test"), testTerminfo(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TERMINFO", dir)
+	ti, err := LoadTerminfo("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Name() != "test" {
+		t.Errorf("expected the test entry, got %q", ti.Name())
+	}
+	if _, err := LoadTerminfo("../test"); err != ErrNoTerminfo {
+		t.Errorf("expected ErrNoTerminfo, got %v", err)
+	}
+	// The entries that are installed on the system use the format with 32-bit numbers
+	if ti, err := LoadTerminfo("xterm-256color"); err == nil && ti.Numbers["colors"] != 256 {
+		t.Errorf("expected 256 colors for xterm-256color, got %d", ti.Numbers["colors"])
+	}
+}
+
+func TestTparm(t *testing.T) {
+	const setaf = "\033[%?%p1%{8}%<%t3%p1%d%e%p1%{16}%<%t9%p1%{8}%-%d%e38;5;%p1%d%;m"
+	for _, tc := range []struct {
+		s    string
+		args []int
+		want string
+	}{
+		{"\033[%i%p1%d;%p2%dH", []int{0, 0}, "\033[1;1H"},
+		{setaf, []int{1}, "\033[31m"},
+		{setaf, []int{12}, "\033[94m"},
+		{setaf, []int{200}, "\033[38;5;200m"},
+		{"%p1%02x%p2%:-3d|", []int{10, 7}, "0a7  |"},
+		{"%p1%Pa%ga%ga%*%d", []int{6}, "36"},
+		{"%'A'%c%{66}%c%%", nil, "AB%"},
+		{"%?%p1%t%p1%l%d%e-%;", []int{12345}, "5"},
+		{"%?%p1%t%p1%l%d%e-%;", []int{0}, "-"},
+		{"%p1%p2%>%!%p1%~%&%d", []int{3, 2}, "0"},
+		{"%?%p1%{1}%=%th%el%;", []int{1}, "h"},
+	} {
+		if got := tparm(tc.s, tc.args...); got != tc.want {
+			t.Errorf("tparm(%q, %v) = %q, want %q", tc.s, tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestTerminalTerminfo(t *testing.T) {
+	ti, err := ParseTerminfo(testTerminfo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	term := NewTerminal(&buf)
+	term.SetXY(2, 3)
+	term.Up(2)
+	if got, want := buf.String(), "\033[4;3H\033[2A"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf.Reset()
+	term.SetTerminfo(ti)
+	term.SetXY(2, 3)
+	term.Up(2)             // only cuu1 is available, so it is repeated
+	term.Clear()           // not clear, which also moves the cursor home
+	term.Column(5)         // hpa is not available, so the VT100 sequence is used
+	term.ShowCursor(false) // and the same for civis
+	term.Send("Scroll Up") // indn is not available, and ind is not used
+	term.Send("Cursor Down")
+	term.Send("Reset Device")
+	if got, want := buf.String(), "\033[4;3H\033[A\033[A\033[2J\033[6G\033[?25l\033[S\033[B\033c"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf.Reset()
+	if err := term.Send("Scroll Region", 1); err == nil {
+		t.Error("expected an error when only some of the parameters are given")
+	}
+	if err := term.Send("Set Attribute Mode", 1, 31); err != nil {
+		t.Error(err)
+	}
+	if got, want := buf.String(), "\033[1;31m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if term.ColorCount() != 8 || term.HasItalics() || term.HasAlternateScreen() {
+		t.Error("unexpected capabilities")
+	}
+}
@@ -23,7 +23,7 @@ func TestToImage(t *testing.T) {
 	// Draw something on the canvas
 	x, y := 10, 5 // Example coordinates
 	canvas.chars[uint(y)*canvas.w+uint(x)].r = 'X'
-	canvas.chars[uint(y)*canvas.w+uint(x)].fg = []byte{31} // Red foreground
+	canvas.chars[uint(y)*canvas.w+uint(x)].fg = internColor([]byte{31}) // Red foreground
 
 	// Generate the image
 	img, err := canvas.ToImage()
@@ -51,3 +51,20 @@ func colorsAreEqual(c1, c2 color.Color) bool {
 	r2, g2, b2, a2 := c2.RGBA()
 	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
 }
+
+func TestToImageCluster(t *testing.T) {
+	// A letter with a combining mark is drawn as the letter
+	c := NewOffscreenCanvas(2, 1)
+	c.WriteString(0, 0, Red, BackgroundBlue, "e\u0301e")
+	img, err := c.ToImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if a, b := img.At(x, y), img.At(x+8, y); !colorsAreEqual(a, b) {
+				t.Fatalf("the cells differ at %d,%d: %v and %v", x, y, a, b)
+			}
+		}
+	}
+}
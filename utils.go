@@ -7,3 +7,19 @@ func umin(a, b uint) uint {
 	}
 	return b
 }
+
+// imin finds the smallest int
+func imin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// imax finds the largest int
+func imax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -8,358 +8,148 @@ import (
 	"sync"
 )
 
-// From http://www.termsys.demon.co.uk/vtansi.htm. Not the full spec, but a good subset.
-// Update: Not even a good subset. Some of the codes are wrong!
-const specVT100 = `
-ANSI/VT100 Terminal Control Escape Sequences
-
-Many computer terminals and terminal emulators support colour and cursor control through a system of escape sequences. One such standard is commonly referred to as ANSI Colour. Several terminal specifications are based on the ANSI colour standard, including VT100.
-
-The following is a partial listing of the VT100 control set.
-
-<ESC> represents the ASCII "escape" character, 0x1B. Bracketed tags represent modifiable decimal parameters; eg. {ROW} would be replaced by a row number.
-
-The following codes are used for reporting terminal/display settings, and vary depending on the implementation:
-
-Query Device Code	<ESC>[c
-    Requests a Report Device Code response from the device.
-
-Report Device Code	<ESC>[{code}0c
-    Generated by the device in response to Query Device Code request.
-
-Query Device Status	<ESC>[5n
-    Requests a Report Device Status response from the device.
-
-Report Device OK	<ESC>[0n
-    Generated by the device in response to a Query Device Status request; indicates that device is functioning correctly.
-
-Report Device Failure	<ESC>[3n
-    Generated by the device in response to a Query Device Status request; indicates that device is functioning improperly.
-
-Query Cursor Position	<ESC>[6n
-    Requests a Report Cursor Position response from the device.
-
-Report Cursor Position	<ESC>[{ROW};{COLUMN}R
-    Generated by the device in response to a Query Cursor Position request; reports current cursor position.
-
-The h and l codes are used for setting terminal/display mode, and vary depending on the implementation. Line Wrap is one of the few setup codes that tend to be used consistently:
-
-Reset Device		<ESC>c
-    Reset all terminal settings to default.
-
-Enable Line Wrap	<ESC>[?7h
-    Text wraps to next line if longer than the length of the display area.
-
-Disable Line Wrap	<ESC>[?7l
-    Disables line wrapping.
-
-Some terminals support multiple fonts: normal/bold, swiss/italic, etc. There are a variety of special codes for certain terminals; the following are fairly standard:
-
-Font Set G0		<ESC>(
-    Set default font.
-
-Font Set G1		<ESC>)
-    Set alternate font.
-
-Cursor Home 		<ESC>[{ROW};{COLUMN}H
-    Sets the cursor position where subsequent text will begin. If no row/column parameters are provided (ie. <ESC>[H), the cursor will move to the home position, at the upper left of the screen.
-
-Cursor Up		<ESC>[{COUNT}A
-    Moves the cursor up by COUNT rows; the default count is 1.
-
-Cursor Down		<ESC>[{COUNT}B
-    Moves the cursor down by COUNT rows; the default count is 1.
-
-Cursor Forward		<ESC>[{COUNT}C
-    Moves the cursor forward by COUNT columns; the default count is 1.
-
-Cursor Backward		<ESC>[{COUNT}D
-    Moves the cursor backward by COUNT columns; the default count is 1.
-
-Force Cursor Position	<ESC>[{ROW};{COLUMN}f
-    Identical to Cursor Home.
-
-Save Cursor		<ESC>[s
-    Save current cursor position.
-
-Unsave Cursor		<ESC>[u
-    Restores cursor position after a Save Cursor.
-
-Save Cursor & Attrs	<ESC>7
-    Save current cursor position.
-
-Restore Cursor & Attrs	<ESC>8
-    Restores cursor position after a Save Cursor.
-
-Scroll Screen		<ESC>[r
-    Enable scrolling for entire display.
-
-Scroll Screen		<ESC>[{start};{end}r
-    Enable scrolling from row {start} to row {end}.
-
-Scroll Down		<ESC>D
-    Scroll display down one line.
-
-Scroll Up		<ESC>M
-    Scroll display up one line.
-
-Set Tab 		<ESC>H
-    Sets a tab at the current position.
-
-Clear Tab 		<ESC>[g
-    Clears tab at the current position.
-
-Clear All Tabs 		<ESC>[3g
-    Clears all tabs.
-
-Erase End of Line	<ESC>[K
-    Erases from the current cursor position to the end of the current line.
-
-Erase Start of Line	<ESC>[1K
-    Erases from the current cursor position to the start of the current line.
-
-Erase Line		<ESC>[2K
-    Erases the entire current line.
-
-Erase Down		<ESC>[J
-    Erases the screen from the current line down to the bottom of the screen.
-
-Erase Up		<ESC>[1J
-    Erases the screen from the current line up to the top of the screen.
-
-Erase Screen		<ESC>[2J
-    Erases the screen with the background colour and moves the cursor to home.
-
-Set Key Definition	<ESC>[{key};"{string}"p
-    Associates a string of text to a keyboard key. {key} indicates the key by its ASCII value in decimal.
-
-Set Attribute Mode	<ESC>[{attr1};...;{attrn}m
-
-    Sets multiple display attribute settings. The following lists standard attributes:
-
-    0	Reset all attributes
-    1	Bright
-    2	Dim
-    4	Underscore
-    5	Blink
-    7	Reverse
-    8	Hidden
-
-    	Foreground Colours
-    30	Black
-    31	Red
-    32	Green
-    33	Yellow
-    34	Blue
-    35	Magenta
-    36	Cyan
-    37	White
-
-    	Background Colours
-    40	Black
-    41	Red
-    42	Green
-    43	Yellow
-    44	Blue
-    45	Magenta
-    46	Cyan
-    47	White
-`
+// attributeNames lists the display attributes and colors that can be given by name,
+// like "Bright" or "Red", for the "Set Attribute Mode" command
+var attributeNames = []struct {
+	code  string
+	name  string
+	group string
+}{
+	{"0", "Reset all attributes", "Attributes"},
+	{"1", "Bright", "Attributes"},
+	{"2", "Dim", "Attributes"},
+	{"4", "Underscore", "Attributes"},
+	{"5", "Blink", "Attributes"},
+	{"7", "Reverse", "Attributes"},
+	{"8", "Hidden", "Attributes"},
+
+	// Not a part of VT100, but supported by most terminal emulators
+	{"3", "Italic", "Attributes"},
+	{"9", "Strikethrough", "Attributes"},
+	{"53", "Overline", "Attributes"},
+	{"4:2", "Double underline", "Attributes"},
+	{"4:3", "Curly underline", "Attributes"},
+	{"4:4", "Dotted underline", "Attributes"},
+	{"4:5", "Dashed underline", "Attributes"},
+
+	{"30", "Black", "Foreground Colours"},
+	{"31", "Red", "Foreground Colours"},
+	{"32", "Green", "Foreground Colours"},
+	{"33", "Yellow", "Foreground Colours"},
+	{"34", "Blue", "Foreground Colours"},
+	{"35", "Magenta", "Foreground Colours"},
+	{"36", "Cyan", "Foreground Colours"},
+	{"37", "White", "Foreground Colours"},
+
+	{"40", "Black", "Background Colours"},
+	{"41", "Red", "Background Colours"},
+	{"42", "Green", "Background Colours"},
+	{"43", "Yellow", "Background Colours"},
+	{"44", "Blue", "Background Colours"},
+	{"45", "Magenta", "Background Colours"},
+	{"46", "Cyan", "Background Colours"},
+	{"47", "White", "Background Colours"},
+}
 
-var specLines = strings.Split(specVT100, "\n")
+// attributeCode returns the SGR parameter for the given attribute or color name, like "31"
+// or "4:3". Foreground colors are found before background colors.
+func attributeCode(name string) (string, bool) {
+	for _, a := range attributeNames {
+		if a.name == name {
+			return a.code, true
+		}
+	}
+	return "", false
+}
 
 // memoization
 var (
-	memo        = make(map[string]string)
-	memoMut     = &sync.RWMutex{}
-	colorLookup = make(map[string]string)
-	colorMut    = &sync.RWMutex{}
+	memo    = make(map[string]string)
+	memoMut = &sync.RWMutex{}
 )
 
-// Given a terminal specification, a command and a map to replace strings with,
-// return the terminal codes. If dummy is true <ESC> is returned instead of \033.
-func get(specVT100, command string, replacemap map[string]string) string {
-	if command == "" {
-		return ""
-	}
-	var sb strings.Builder
-	sb.WriteString("get:")
-	sb.WriteString(command)
-	for k, v := range replacemap {
-		sb.WriteString(k)
-		sb.WriteString(v)
-		sb.WriteString(";")
-	}
-	combined := sb.String()
-
-	memoMut.RLock()
-	if val, ok := memo[combined]; ok {
-		memoMut.RUnlock()
-		return val
-	}
-	memoMut.RUnlock()
-
-	for _, line := range specLines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, command) {
-			termCommand := strings.TrimSpace(trimmed[len(command):])
-			for k, v := range replacemap {
-				termCommand = strings.Replace(termCommand, k, v, 1)
-			}
-			// Return the terminal command
-			termCommand = strings.Replace(termCommand, "<ESC>", "\033", -1)
-
-			memoMut.Lock()
-			memo[combined] = termCommand
-			memoMut.Unlock()
-
-			return termCommand
-		}
-	}
-	return ""
-}
-
 // Return the terminal command, given a map to replace the values mentioned in the spec.
 func Get(command string, replacemap map[string]string) string {
-	return get(specVT100, command, replacemap)
+	return get(command, replacemap)
 }
 
 // Do the terminal command, given a map to replace the values mentioned in the spec.
 func Set(command string, replacemap map[string]string) {
-	fmt.Print(get(specVT100, command, replacemap))
+	stdoutTerminal.Set(command, replacemap)
 }
 
 // Do the given command, with no parameters
 func Do(command string) {
-	fmt.Print(get(specVT100, command, map[string]string{}))
+	stdoutTerminal.Do(command)
+}
+
+// Send the terminal command with the given name, like "Cursor Up", and parameters.
+// Returns an error if there is no command with that name, or if some, but not all,
+// of the parameters are given.
+func Send(command string, args ...uint) error {
+	return send(stdoutTerminal, command, args...)
 }
 
 // Get the terminal command for setting a given color number
 func ColorNum(colorNum int) string {
-	return get(specVT100, "Set Attribute Mode", map[string]string{"{attr1};...;{attrn}": strconv.Itoa(colorNum)})
+	return get("Set Attribute Mode", map[string]string{"{ATTRIBUTES}": strconv.Itoa(colorNum)})
 }
 
 // Execute the terminal command for setting a given color number
 func SetColorNum(colorNum int) {
-	fmt.Print(ColorNum(colorNum))
+	stdoutTerminal.SetColorNum(colorNum)
 }
 
-// Returns the number (as a string) for a given attribute name.
+// Returns the number (as a string) for a given attribute name, or the number and the
+// sub-parameter for the underline styles, like "4:3".
 // Returns the given string if the attribute was not found in the spec.
 func AttributeNumber(name string) string {
-	colorMut.RLock()
-	if val, ok := colorLookup[name]; ok {
-		colorMut.RUnlock()
-		return val
-	}
-	colorMut.RUnlock()
-	for _, line := range specLines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasSuffix(trimmed, name) {
-			colorName := strings.TrimSpace(trimmed[:len(trimmed)-len(name)])
-			colorMut.Lock()
-			colorLookup[name] = colorName
-			colorMut.Unlock()
-			return colorName
-		}
+	if code, ok := attributeCode(name); ok {
+		return code
 	}
 	return name
 }
 
 // Execute the terminal command for setting a given display attribute name, like "Bright" or "Blink"
 func AttributeOrColor(name string) string {
-	combined := "DA:" + name
-	memoMut.RLock()
-	if val, ok := memo[combined]; ok {
-		memoMut.RUnlock()
-		return val
-	}
-	memoMut.RUnlock()
-	for _, line := range specLines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasSuffix(trimmed, name) {
-			numString := strings.TrimSpace(trimmed[:len(trimmed)-len(name)])
-			num, err := strconv.Atoi(numString)
-			if err != nil {
-				return ""
-			}
-			termCommand := ColorNum(num)
-			memoMut.Lock()
-			memo[combined] = termCommand
-			memoMut.Unlock()
-			return termCommand
-		}
+	code, ok := attributeCode(name)
+	if !ok {
+		return ""
 	}
-	return ""
+	return get("Set Attribute Mode", map[string]string{"{ATTRIBUTES}": code})
 }
 
 // Execute the terminal command for setting a given display attribute name, like "Bright" or "Blink"
 func SetAttribute(name string) {
-	fmt.Print(AttributeOrColor(name))
+	stdoutTerminal.SetAttribute(name)
 }
 
 // Get the terminal command for setting no colors or other display attributes
 func NoColor() string {
-	return get(specVT100, "Set Attribute Mode", map[string]string{"{attr1};...;{attrn}": "0"})
+	return get("Set Attribute Mode", map[string]string{"{ATTRIBUTES}": "0"})
 }
 
 // Execute the terminal command for setting no colors or other display attributes
 func SetNoColor() {
-	fmt.Print(NoColor())
+	stdoutTerminal.SetNoColor()
 }
 
 // Get the terminal command for setting a terminal attribute and a color
 func AttributeAndColor(attr, name string) string {
-	combined := "AAC:" + attr + name
-	memoMut.RLock()
-	if val, ok := memo[combined]; ok {
-		memoMut.RUnlock()
-		return val
+	code, ok := attributeCode(name)
+	if !ok {
+		return ""
 	}
-	memoMut.RUnlock()
 	attribute := ""
-	for _, line := range specLines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasSuffix(trimmed, attr) {
-			attribute = strings.TrimSpace(trimmed[:len(trimmed)-len(attr)]) + ";"
-			break
-		}
+	if attrCode, ok := attributeCode(attr); ok {
+		attribute = attrCode + ";"
 	}
-	for _, line := range specLines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasSuffix(trimmed, name) {
-			numString := strings.TrimSpace(trimmed[:len(trimmed)-len(name)])
-			termCommand := get(specVT100, "Set Attribute Mode", map[string]string{"{attr1};...;{attrn}": attribute + numString})
-			memoMut.Lock()
-			memo[combined] = termCommand
-			memoMut.Unlock()
-			return termCommand
-		}
-	}
-	return ""
+	return get("Set Attribute Mode", map[string]string{"{ATTRIBUTES}": attribute + code})
 }
 
 // Execute the terminal command for setting a terminal attribute and a color
 func SetAttributeAndColor(attr, name string) {
-	fmt.Print(AttributeAndColor(attr, name))
-}
-
-// Return all available commands
-func Commands() []string {
-	var commands []string
-	for _, line := range specLines {
-		if strings.Contains(line, "<ESC>") {
-			elements := strings.SplitN(line, "<ESC>", 2)
-			if len(elements) > 0 {
-				command := strings.TrimSpace(elements[0])
-				if command == "" || strings.Contains(command, ".") {
-					continue
-				}
-				commands = append(commands, command)
-			}
-		}
-	}
-	return commands
+	stdoutTerminal.SetAttributeAndColor(attr, name)
 }
 
 // Check if a given string slice has the given string
@@ -375,24 +165,9 @@ func has(sl []string, s string) bool {
 // Return all available colors
 func Colors() []string {
 	var colors []string
-	colormode := false
-	for _, line := range specLines {
-		trimmed := strings.TrimSpace(line)
-		if strings.Contains(trimmed, "Colours") || strings.Contains(trimmed, "Colors") {
-			colormode = true
-			continue
-		} else if trimmed == "" {
-			colormode = false
-			continue
-		}
-		if colormode {
-			fields := strings.Fields(trimmed)
-			if len(fields) > 1 {
-				color := strings.TrimSpace(fields[1])
-				if !has(colors, color) {
-					colors = append(colors, fields[1])
-				}
-			}
+	for _, a := range attributeNames {
+		if strings.HasSuffix(a.group, "Colours") && !has(colors, a.name) {
+			colors = append(colors, a.name)
 		}
 	}
 	return colors
@@ -409,38 +184,39 @@ func DarkColor(text, color string) string {
 }
 
 func Init() {
-	Reset()
-	Clear()
-	ShowCursor(false)
-	SetLineWrap(false)
-	EchoOff()
+	stdoutTerminal.Init()
 }
 
 func Close() {
-	SetLineWrap(true)
-	ShowCursor(true)
-	Home()
+	stdoutTerminal.Close()
+}
+
+// UseAlternateScreen makes Init enter the alternate screen buffer and Close leave it,
+// so that the screen contents and scrollback of the shell are kept intact
+func UseAlternateScreen(enable bool) {
+	stdoutTerminal.UseAlternateScreen(enable)
+}
+
+// EnterAlternateScreen switches to the alternate screen buffer
+func EnterAlternateScreen() {
+	stdoutTerminal.EnterAlternateScreen()
+}
+
+// LeaveAlternateScreen switches back to the normal screen buffer
+func LeaveAlternateScreen() {
+	stdoutTerminal.LeaveAlternateScreen()
 }
 
 func EchoOff() {
-	fmt.Print("\033[12h")
+	stdoutTerminal.EchoOff()
 }
 
 func SetLineWrap(enable bool) {
-	if enable {
-		Do("Enable Line Wrap")
-	} else {
-		Do("Disable Line Wrap")
-	}
+	stdoutTerminal.SetLineWrap(enable)
 }
 
 func ShowCursor(enable bool) {
-	// Thanks https://rosettacode.org/wiki/Terminal_control/Hiding_the_cursor#Escape_code
-	if enable {
-		fmt.Print("\033[?25h")
-	} else {
-		fmt.Print("\033[?25l")
-	}
+	stdoutTerminal.ShowCursor(enable)
 }
 
 // GetBackgroundColor prints a code to the terminal emulator,
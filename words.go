@@ -6,6 +6,7 @@ import (
 
 // Words takes a string with words and several color-strings, like "blue". Color the
 // words with the corresponding colors and return the string.
+// The words are not colored if colors should not be written to stdout (see ColorEnabled).
 func Words(line string, colors ...string) string {
 	var ok bool
 	words := strings.Split(line, " ")